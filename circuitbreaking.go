@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	ec "github.com/trivago/exporter-edgecast/edgecast"
+)
+
+// states of a circuit breaker, exported as value of the circuitState gauge
+const (
+	circuitClosed   = 0
+	circuitHalfOpen = 1
+	circuitOpen     = 2
+)
+
+// errCircuitOpen is returned without calling the wrapped EdgecastInterface while its circuit breaker is open
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+/*
+ * circuitBreakerMiddleware wraps a given EdgecastInterface and stops calling its functions while they keep failing.
+ * Every function/platform pair has its own circuit breaker:
+ * - closed:	calls are passed on, the breaker opens after failureThreshold consecutive failures
+ * 			(rejected requests like 4xx responses prove the API to be available and don't count as failures)
+ * - open:		calls fail fast with errCircuitOpen until openTimeout has passed
+ * - half-open:	a single trial call is passed on, closing the breaker on success and opening it again on failure
+ * The state of every breaker is exported by the circuitState gauge (0 = closed, 1 = half-open, 2 = open).
+ */
+type circuitBreakerMiddleware struct {
+	account      string
+	breakers     *circuitBreakers
+	circuitState metrics.Gauge // positive and negative counting value
+	next         EdgecastInterface
+}
+
+// circuitBreakers holds the state of all circuit breakers of an account
+// - shared by all service chains of the account, so probes see the same state as the poller
+type circuitBreakers struct {
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mtx      sync.Mutex
+	breakers map[breakerKey]*circuitBreaker
+}
+
+// breakerKey identifies the circuit breaker of a function/platform pair
+type breakerKey struct {
+	method   string
+	platform int
+}
+
+// circuitBreaker holds the state of a single function/platform pair
+type circuitBreaker struct {
+	state    int
+	failures int       // consecutive failures while closed
+	openedAt time.Time // time of the last transition to open
+	trial    bool      // whether the trial call of the half-open state is in flight
+}
+
+// newCircuitBreakers creates the circuit breakers of an account
+func newCircuitBreakers(failureThreshold int, openTimeout time.Duration) *circuitBreakers {
+	return &circuitBreakers{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		breakers:         make(map[breakerKey]*circuitBreaker),
+	}
+}
+
+func (mw circuitBreakerMiddleware) Bandwidth(ctx context.Context, platform int) (bandwidthData *ec.BandwidthData, err error) {
+	if err = mw.allow("Bandwidth", platform); err != nil {
+		return nil, err
+	}
+	defer func() { mw.record(ctx, "Bandwidth", platform, err) }()
+
+	bandwidthData, err = mw.next.Bandwidth(ctx, platform) // hand function call to service
+	return
+}
+
+func (mw circuitBreakerMiddleware) Connections(ctx context.Context, platform int) (connectionData *ec.ConnectionData, err error) {
+	if err = mw.allow("Connections", platform); err != nil {
+		return nil, err
+	}
+	defer func() { mw.record(ctx, "Connections", platform, err) }()
+
+	connectionData, err = mw.next.Connections(ctx, platform) // hand function call to service
+	return
+}
+
+func (mw circuitBreakerMiddleware) CacheStatus(ctx context.Context, platform int) (cacheStatusData *ec.CacheStatusData, err error) {
+	if err = mw.allow("CacheStatus", platform); err != nil {
+		return nil, err
+	}
+	defer func() { mw.record(ctx, "CacheStatus", platform, err) }()
+
+	cacheStatusData, err = mw.next.CacheStatus(ctx, platform) // hand function call to service
+	return
+}
+
+func (mw circuitBreakerMiddleware) StatusCodes(ctx context.Context, platform int) (statusCodeData *ec.StatusCodeData, err error) {
+	if err = mw.allow("StatusCodes", platform); err != nil {
+		return nil, err
+	}
+	defer func() { mw.record(ctx, "StatusCodes", platform, err) }()
+
+	statusCodeData, err = mw.next.StatusCodes(ctx, platform) // hand function call to service
+	return
+}
+
+func (mw circuitBreakerMiddleware) DataTransferred(ctx context.Context, platform int, period ec.ReportPeriod) (dataTransferData *ec.DataTransferData, err error) {
+	if err = mw.allow("DataTransferred", platform); err != nil {
+		return nil, err
+	}
+	defer func() { mw.record(ctx, "DataTransferred", platform, err) }()
+
+	dataTransferData, err = mw.next.DataTransferred(ctx, platform, period) // hand function call to service
+	return
+}
+
+func (mw circuitBreakerMiddleware) CNAMEReport(ctx context.Context, platform int, period ec.ReportPeriod) (cnameReportData *ec.TrafficReportData, err error) {
+	if err = mw.allow("CNAMEReport", platform); err != nil {
+		return nil, err
+	}
+	defer func() { mw.record(ctx, "CNAMEReport", platform, err) }()
+
+	cnameReportData, err = mw.next.CNAMEReport(ctx, platform, period) // hand function call to service
+	return
+}
+
+func (mw circuitBreakerMiddleware) OriginReport(ctx context.Context, platform int, period ec.ReportPeriod) (originReportData *ec.TrafficReportData, err error) {
+	if err = mw.allow("OriginReport", platform); err != nil {
+		return nil, err
+	}
+	defer func() { mw.record(ctx, "OriginReport", platform, err) }()
+
+	originReportData, err = mw.next.OriginReport(ctx, platform, period) // hand function call to service
+	return
+}
+
+// PurgeRequests isn't bound to a platform, so its circuit breaker is the one of platform 0
+func (mw circuitBreakerMiddleware) PurgeRequests(ctx context.Context, since time.Time) (purgeRequestData *ec.PurgeRequestData, err error) {
+	if err = mw.allow("PurgeRequests", 0); err != nil {
+		return nil, err
+	}
+	defer func() { mw.record(ctx, "PurgeRequests", 0, err) }()
+
+	purgeRequestData, err = mw.next.PurgeRequests(ctx, since) // hand function call to service
+	return
+}
+
+func (mw circuitBreakerMiddleware) Purge(ctx context.Context, platform int, path string) (purgeData *ec.PurgeData, err error) {
+	if err = mw.allow("Purge", platform); err != nil {
+		return nil, err
+	}
+	defer func() { mw.record(ctx, "Purge", platform, err) }()
+
+	purgeData, err = mw.next.Purge(ctx, platform, path) // hand function call to service
+	return
+}
+
+// allow returns errCircuitOpen if the breaker of the given function/platform pair rejects the call
+// - an open breaker turns half-open once its open timeout has passed and lets a single trial call through
+func (mw circuitBreakerMiddleware) allow(method string, platform int) error {
+	mw.breakers.mtx.Lock()
+	defer mw.breakers.mtx.Unlock()
+
+	b := mw.breaker(method, platform)
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < mw.breakers.openTimeout {
+			return errCircuitOpen
+		}
+		mw.transition(method, platform, b, circuitHalfOpen)
+		b.trial = true
+	case circuitHalfOpen:
+		if b.trial {
+			return errCircuitOpen
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// record updates the breaker of the given function/platform pair with the outcome of a call
+// - calls aborted because their context is done don't count as failures
+// - calls rejected by the API count as successes, the API answered after all
+func (mw circuitBreakerMiddleware) record(ctx context.Context, method string, platform int, err error) {
+	mw.breakers.mtx.Lock()
+	defer mw.breakers.mtx.Unlock()
+
+	b := mw.breaker(method, platform)
+	b.trial = false
+	switch {
+	case err == nil || rejected(err):
+		b.failures = 0
+		if b.state != circuitClosed {
+			mw.transition(method, platform, b, circuitClosed)
+		}
+	case ctx.Err() != nil:
+		// the trial call of a half-open breaker has to be repeated
+	case b.state == circuitHalfOpen:
+		mw.transition(method, platform, b, circuitOpen)
+	default:
+		b.failures++
+		if b.failures >= mw.breakers.failureThreshold {
+			mw.transition(method, platform, b, circuitOpen)
+		}
+	}
+}
+
+// rejected() reports whether the API answered a call with a client error, e.g. an invalid token or purge path
+func rejected(err error) bool {
+	switch err.(type) {
+	case *ec.AuthError, *ec.StatusError:
+		return true
+	default:
+		return false
+	}
+}
+
+// breaker returns the breaker of the given function/platform pair, creating a closed one on first use
+// - the caller must hold the lock
+func (mw circuitBreakerMiddleware) breaker(method string, platform int) *circuitBreaker {
+	key := breakerKey{method, platform}
+	b, ok := mw.breakers.breakers[key]
+	if !ok {
+		b = &circuitBreaker{state: circuitClosed}
+		mw.breakers.breakers[key] = b
+		mw.circuitState.With("account", mw.account, "method", method, "platform", Platforms[platform]).Set(circuitClosed)
+	}
+	return b
+}
+
+// transition moves the given breaker to a new state and exports it
+// - the caller must hold the lock
+func (mw circuitBreakerMiddleware) transition(method string, platform int, b *circuitBreaker, state int) {
+	b.state = state
+	b.failures = 0
+	if state == circuitOpen {
+		b.openedAt = time.Now()
+	}
+	mw.circuitState.With("account", mw.account, "method", method, "platform", Platforms[platform]).Set(float64(state))
+}
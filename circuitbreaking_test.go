@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/trivago/exporter-edgecast/edgecast"
+)
+
+// breakerService answers Bandwidth with err (or the fixture if nil) and counts the calls passed through
+// - if block is set, every call waits for it to be closed first
+type breakerService struct {
+	fixtureService
+	err   error
+	block chan struct{}
+
+	mtx   sync.Mutex
+	calls int
+}
+
+func (s *breakerService) Bandwidth(ctx context.Context, platform int) (*edgecast.BandwidthData, error) {
+	s.mtx.Lock()
+	s.calls++
+	s.mtx.Unlock()
+	if s.block != nil {
+		<-s.block
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.fixtureService.Bandwidth(ctx, platform)
+}
+
+// newTestBreaker wraps svc in a circuit breaker opening after 3 failures for 20ms, exporting its state to the returned gauge
+func newTestBreaker(svc EdgecastInterface) (circuitBreakerMiddleware, *prometheus.GaugeVec) {
+	state := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "edgecast_circuit_state"}, []string{"account", "method", "platform"})
+	return circuitBreakerMiddleware{"main", newCircuitBreakers(3, 20*time.Millisecond), kitprometheus.NewGauge(state), svc}, state
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	failure := &edgecast.ServerError{StatusCode: http.StatusBadGateway}
+	rejection := &edgecast.StatusError{StatusCode: http.StatusBadRequest}
+
+	// step is a single call of the breaker
+	type step struct {
+		err     error // returned by the wrapped service, context.Canceled cancels the call's context
+		wait    bool  // wait for the open timeout before the call
+		through bool  // whether the call reaches the wrapped service
+		state   int   // exported state afterwards
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"opens after failure_threshold consecutive failures", []step{
+			{err: failure, through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitOpen},
+		}},
+		{"fails fast while open", []step{
+			{err: failure, through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitOpen},
+			{through: false, state: circuitOpen},
+			{through: false, state: circuitOpen},
+		}},
+		{"success resets the failures", []step{
+			{err: failure, through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitClosed},
+			{through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitClosed},
+		}},
+		{"closes on trial success", []step{
+			{err: failure, through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitOpen},
+			{wait: true, through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitClosed},
+		}},
+		{"reopens on trial failure", []step{
+			{err: failure, through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitOpen},
+			{err: failure, wait: true, through: true, state: circuitOpen},
+			{through: false, state: circuitOpen},
+		}},
+		{"doesn't count cancelled calls", []step{
+			{err: context.Canceled, through: true, state: circuitClosed},
+			{err: context.Canceled, through: true, state: circuitClosed},
+			{err: context.Canceled, through: true, state: circuitClosed},
+			{err: context.Canceled, through: true, state: circuitClosed},
+		}},
+		{"repeats a cancelled trial", []step{
+			{err: failure, through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitClosed},
+			{err: failure, through: true, state: circuitOpen},
+			{err: context.Canceled, wait: true, through: true, state: circuitHalfOpen},
+			{through: true, state: circuitClosed},
+		}},
+		{"doesn't count rejected calls", []step{
+			{err: rejection, through: true, state: circuitClosed},
+			{err: rejection, through: true, state: circuitClosed},
+			{err: rejection, through: true, state: circuitClosed},
+			{err: &edgecast.AuthError{StatusCode: http.StatusForbidden}, through: true, state: circuitClosed},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &breakerService{fixtureService: fixtureService{t}}
+			mw, state := newTestBreaker(svc)
+			for i, s := range tt.steps {
+				if s.wait {
+					time.Sleep(25 * time.Millisecond)
+				}
+				ctx, cancel := context.WithCancel(context.Background())
+				if s.err == context.Canceled {
+					cancel()
+				}
+				svc.err, svc.calls = s.err, 0
+				_, err := mw.Bandwidth(ctx, 3)
+				cancel()
+
+				if through := svc.calls == 1; through != s.through {
+					t.Errorf("step %d: call passed through = %v, want %v", i, through, s.through)
+				}
+				if !s.through && err != errCircuitOpen {
+					t.Errorf("step %d: error = %v, want %v", i, err, errCircuitOpen)
+				}
+				if got := testutil.ToFloat64(state.WithLabelValues("main", "Bandwidth", "http_large")); got != float64(s.state) {
+					t.Errorf("step %d: exported state = %v, want %d", i, got, s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerSingleTrial(t *testing.T) {
+	svc := &breakerService{fixtureService: fixtureService{t}, err: &edgecast.ServerError{StatusCode: http.StatusBadGateway}}
+	mw, state := newTestBreaker(svc)
+	for i := 0; i < 3; i++ {
+		_, _ = mw.Bandwidth(context.Background(), 3)
+	}
+	time.Sleep(25 * time.Millisecond)
+
+	// the trial call blocks, so all further calls arrive while it is in flight
+	svc.err, svc.calls, svc.block = nil, 0, make(chan struct{})
+	trial := make(chan error)
+	go func() {
+		_, err := mw.Bandwidth(context.Background(), 3)
+		trial <- err
+	}()
+	for {
+		svc.mtx.Lock()
+		started := svc.calls == 1
+		svc.mtx.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := testutil.ToFloat64(state.WithLabelValues("main", "Bandwidth", "http_large")); got != circuitHalfOpen {
+		t.Errorf("exported state during the trial = %v, want %d", got, circuitHalfOpen)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := mw.Bandwidth(context.Background(), 3); err != errCircuitOpen {
+			t.Errorf("call during the trial: error = %v, want %v", err, errCircuitOpen)
+		}
+	}
+
+	close(svc.block)
+	if err := <-trial; err != nil {
+		t.Errorf("trial call: error = %v, want nil", err)
+	}
+	if svc.calls != 1 {
+		t.Errorf("passed %d calls through while half-open, want only the trial", svc.calls)
+	}
+	if got := testutil.ToFloat64(state.WithLabelValues("main", "Bandwidth", "http_large")); got != circuitClosed {
+		t.Errorf("exported state after the trial = %v, want %d", got, circuitClosed)
+	}
+}
@@ -1,141 +1,393 @@
 package main
 
 import (
+	"context"
+	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
-	"github.com/mre/edgecast"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/trivago/exporter-edgecast/edgecast"
 )
 
 // EdgecastInterface to be used for logging and instrumenting middleware
+// - every call is bound to the given context and aborted once it is done
 type EdgecastInterface interface {
-	Bandwidth(int) (*edgecast.BandwidthData, error)
-	Connections(int) (*edgecast.ConnectionData, error)
-	CacheStatus(int) (*edgecast.CacheStatusData, error)
-	StatusCodes(int) (*edgecast.StatusCodeData, error)
+	Bandwidth(context.Context, int) (*edgecast.BandwidthData, error)
+	Connections(context.Context, int) (*edgecast.ConnectionData, error)
+	CacheStatus(context.Context, int) (*edgecast.CacheStatusData, error)
+	StatusCodes(context.Context, int) (*edgecast.StatusCodeData, error)
+	DataTransferred(context.Context, int, edgecast.ReportPeriod) (*edgecast.DataTransferData, error)
+	CNAMEReport(context.Context, int, edgecast.ReportPeriod) (*edgecast.TrafficReportData, error)
+	OriginReport(context.Context, int, edgecast.ReportPeriod) (*edgecast.TrafficReportData, error)
+	PurgeRequests(context.Context, time.Time) (*edgecast.PurgeRequestData, error)
+	Purge(context.Context, int, string) (*edgecast.PurgeData, error)
 }
 
 // EdgecastCollector needs an edgecast client that implements the given interface to fetch metrics from edgecast API
+// - if a poller is attached, scrapes are served from its latest snapshot instead of querying the API
 type EdgecastCollector struct {
-	ec        EdgecastInterface
-	platforms map[int]string
+	ctx     context.Context // bounds the API calls of a scrape without poller
+	account string          // value of the account label on every exposed series
+	ec      EdgecastInterface
+	metrics metricSelection // metric types fetched per platform
+	poller  *Poller
+
+	opts collectorOptions
+}
+
+// collectorOptions holds the settings of how fetched metrics are exposed, shared by all collectors of a configuration
+type collectorOptions struct {
+	legacyNames   bool              // additionally expose the fetched metrics under their legacy names
+	statusClasses bool              // additionally expose the status codes re-aggregated into the classes 1xx to 5xx
+	cacheClasses  map[string]string // class of every known cache status, see cacheClass()
+}
+
+// metricSelection maps every scraped platform to the metric types fetched for it
+type metricSelection map[int][]string
+
+// selectMetrics() selects the same metric types for all given platforms
+func selectMetrics(platforms map[int]string, metrics []string) metricSelection {
+	selection := make(metricSelection, len(platforms))
+	for p := range platforms {
+		selection[p] = metrics
+	}
+	return selection
+}
+
+// platforms() returns the selected platforms mapped to their names
+func (s metricSelection) platforms() map[int]string {
+	platforms := make(map[int]string, len(s))
+	for p := range s {
+		platforms[p] = Platforms[p]
+	}
+	return platforms
+}
+
+// restrict() returns the selection of only the given platforms
+func (s metricSelection) restrict(platforms map[int]string) metricSelection {
+	restricted := make(metricSelection, len(platforms))
+	for p, metrics := range s {
+		if _, ok := platforms[p]; ok {
+			restricted[p] = metrics
+		}
+	}
+	return restricted
+}
+
+// includes() reports whether the metric type is fetched for at least one platform
+func (s metricSelection) includes(metric string) bool {
+	for _, metrics := range s {
+		if contains(metrics, metric) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchResult holds the outcome of fetching a single metric type for a single platform
+type fetchResult struct {
+	platform  int
+	metric    string
+	data      interface{} // *edgecast.BandwidthData, *edgecast.ConnectionData, *edgecast.CacheStatusData or *edgecast.StatusCodeData
+	err       error
+	duration  time.Duration // duration of the last fetch
+	fetched   time.Time     // time of the last fetch, successful or not
+	timestamp time.Time     // time of the last successful fetch
 }
 
 const (
 	// NAMESPACE declaration for all exposed metrics in Prometheus
 	NAMESPACE = "Edgecast"
+
+	// scrapeTimeoutOffset is subtracted from the scrape timeout announced by Prometheus to leave time for exposing the metrics
+	scrapeTimeoutOffset = 500 * time.Millisecond
+
+	// metric types that are fetched for every platform
+	metricBandwidth   = "bandwidth"
+	metricConnections = "connections"
+	metricCacheStatus = "cachestatus"
+	metricStatusCodes = "statuscodes"
 )
 
 var (
+	// metricTypes lists all metric types that are fetched for every platform
+	metricTypes = []string{metricBandwidth, metricConnections, metricCacheStatus, metricStatusCodes}
+
 	// Prepared Description of all fetchable metrics
 	bandwidth = prometheus.NewDesc(
-		prometheus.BuildFQName(NAMESPACE, "metrics", "bandwidth_bps"), "Current amount of bandwidth usage per platform (bits per second).", []string{"platform"}, nil,
+		prometheus.BuildFQName("edgecast", "", "bandwidth_bits_per_second"), "Current bandwidth usage per platform in bits per second.", []string{"account", "platform"}, nil,
 	)
-	cachestatus = prometheus.NewDesc(
-		prometheus.BuildFQName(NAMESPACE, "metrics", "cachestatus"), "Breakdown of the cache statuses currently being returned for requests to CDN account.", []string{"platform", "CacheStatus"}, nil,
+	cacheStatus = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "cache_status", "connections"), "Current connections per platform and cache status.", []string{"account", "platform", "cache_status"}, nil,
 	)
 	connections = prometheus.NewDesc(
-		prometheus.BuildFQName(NAMESPACE, "metrics", "connections"), "Total active connections per second per platform.", []string{"platform"}, nil,
+		prometheus.BuildFQName("edgecast", "", "connections"), "Current active connections per platform.", []string{"account", "platform"}, nil,
+	)
+	statusCodes = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "status_code", "connections"), "Current connections per platform and HTTP status code (or class of status codes).", []string{"account", "platform", "status_code", "status_class"}, nil,
+	)
+
+	// Prepared Description of all fetchable metrics under their names before the Prometheus naming conventions were adopted,
+	// only exposed with --metrics.legacy-names
+	legacyBandwidth = prometheus.NewDesc(
+		prometheus.BuildFQName(NAMESPACE, "metrics", "bandwidth_bps"), "Current amount of bandwidth usage per platform (bits per second).", []string{"account", "platform"}, nil,
+	)
+	legacyCacheStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(NAMESPACE, "metrics", "cachestatus"), "Breakdown of the cache statuses currently being returned for requests to CDN account.", []string{"account", "platform", "CacheStatus"}, nil,
+	)
+	legacyConnections = prometheus.NewDesc(
+		prometheus.BuildFQName(NAMESPACE, "metrics", "connections"), "Total active connections per second per platform.", []string{"account", "platform"}, nil,
+	)
+	legacyStatusCodes = prometheus.NewDesc(
+		prometheus.BuildFQName(NAMESPACE, "metrics", "statuscodes"), "Breakdown of the HTTP status codes currently being returned for requests to CDN account.", []string{"account", "platform", "StatusCode"}, nil,
+	)
+
+	scrapeSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "scrape", "success"), "Whether the last fetch from the Edgecast API succeeded per platform and metric type.", []string{"account", "platform", "metric"}, nil,
+	)
+	scrapeDuration = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "scrape", "duration_seconds"), "Duration of the last fetch from the Edgecast API per platform and metric type.", []string{"account", "platform", "metric"}, nil,
+	)
+	up = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "", "up"), "Whether the last fetch from the Edgecast API succeeded for at least one platform and metric type.", []string{"account"}, nil,
 	)
-	statuscodes = prometheus.NewDesc(
-		prometheus.BuildFQName(NAMESPACE, "metrics", "statuscodes"), "Breakdown of the HTTP status codes currently being returned for requests to CDN account.", []string{"platform", "StatusCode"}, nil,
+	snapshotAge = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "snapshot", "age_seconds"), "Time since the last successful background fetch per platform and metric type.", []string{"account", "platform", "metric"}, nil,
 	)
 )
 
-// NewEdgecastCollector constructs a new EdgecastCollector using a given edgecast-client that implements the EdgecastInterface
-func NewEdgecastCollector(client *EdgecastInterface, platforms map[int]string) *EdgecastCollector {
-	return &EdgecastCollector{ec: *client, platforms: platforms}
+// NewEdgecastCollector constructs a new EdgecastCollector for an account using a given edgecast-client that implements the EdgecastInterface
+// - every scrape queries the API directly and is cancelled once ctx is done
+func NewEdgecastCollector(ctx context.Context, account string, client *EdgecastInterface, metrics metricSelection, opts collectorOptions) *EdgecastCollector {
+	return &EdgecastCollector{ctx: ctx, account: account, ec: *client, metrics: metrics, opts: opts}
+}
+
+// NewPollingEdgecastCollector constructs a new EdgecastCollector for an account that serves every scrape from the latest snapshot of the given poller
+func NewPollingEdgecastCollector(account string, poller *Poller, opts collectorOptions) *EdgecastCollector {
+	return &EdgecastCollector{account: account, ec: poller.ec, metrics: poller.metrics, poller: poller, opts: opts}
 }
 
 // Describe describes all exported metrics
-//- implements function of interface prometheus.Collector
+// - metrics of metric types that aren't fetched for any platform are left out
+// - implements function of interface prometheus.Collector
 func (col EdgecastCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- bandwidth
-	ch <- cachestatus
-	ch <- connections
-	ch <- statuscodes
+	if col.metrics.includes(metricBandwidth) {
+		ch <- bandwidth
+		if col.opts.legacyNames {
+			ch <- legacyBandwidth
+		}
+	}
+	if col.metrics.includes(metricCacheStatus) {
+		ch <- cacheStatus
+		ch <- cacheClassConnections
+		ch <- cacheHitRatio
+		if col.opts.legacyNames {
+			ch <- legacyCacheStatus
+		}
+	}
+	if col.metrics.includes(metricConnections) {
+		ch <- connections
+		if col.opts.legacyNames {
+			ch <- legacyConnections
+		}
+	}
+	if col.metrics.includes(metricStatusCodes) {
+		ch <- statusCodes
+		ch <- errorRatio
+		if col.opts.statusClasses {
+			ch <- statusClassConnections
+		}
+		if col.opts.legacyNames {
+			ch <- legacyStatusCodes
+		}
+	}
+	ch <- scrapeSuccess
+	ch <- scrapeDuration
+	ch <- up
+	if col.poller != nil {
+		ch <- snapshotAge
+	}
 }
 
 // Collect is called by Prometheus Server
-// - concurrently fetches metrics for all possible platforms and exposes them in Prometheus format
-//- implements function of interface prometheus.Collector
+// - exposes the poller's latest snapshot, or concurrently fetches the selected metrics of all platforms if there is no poller
+// - implements function of interface prometheus.Collector
 func (col EdgecastCollector) Collect(ch chan<- prometheus.Metric) {
-	var collectWaitGroup sync.WaitGroup
-	for p := range col.platforms { // for each possible platform concurrently
-		collectWaitGroup.Add(1)
-		go col.metrics(ch, &collectWaitGroup, p) // fetch all possible metrics concurrently
+	var results []fetchResult
+	if col.poller != nil {
+		results = col.poller.snapshot()
+	} else {
+		results = fetch(col.ctx, col.ec, col.metrics)
 	}
-	collectWaitGroup.Wait()
-}
 
-// metrics() concurrently fetches all possible metric types for a given platform
-func (col EdgecastCollector) metrics(ch chan<- prometheus.Metric, collectWaitgroup *sync.WaitGroup, platform int) {
-	var metricsWaitGroup sync.WaitGroup
-	metricsWaitGroup.Add(4) // 4 goroutines per platform for the 4 possible metric types
-	go col.bandwidth(ch, &metricsWaitGroup, platform)
-	go col.connections(ch, &metricsWaitGroup, platform)
-	go col.cachestatus(ch, &metricsWaitGroup, platform)
-	go col.statuscodes(ch, &metricsWaitGroup, platform)
-	metricsWaitGroup.Wait() // wait for metric-fetching to finish
-	collectWaitgroup.Done() // DONE fetching and exposing metrics for this platform
+	upVal := 0.0
+	for _, r := range results {
+		successVal := 0.0
+		if r.err == nil {
+			successVal = 1
+			upVal = 1
+		}
+		ch <- prometheus.MustNewConstMetric(scrapeSuccess, prometheus.GaugeValue, successVal, col.account, Platforms[r.platform], r.metric)
+		ch <- prometheus.MustNewConstMetric(scrapeDuration, prometheus.GaugeValue, r.duration.Seconds(), col.account, Platforms[r.platform], r.metric)
+		if col.poller != nil && !r.timestamp.IsZero() {
+			ch <- prometheus.MustNewConstMetric(snapshotAge, prometheus.GaugeValue, time.Since(r.timestamp).Seconds(), col.account, Platforms[r.platform], r.metric)
+		}
+		if r.timestamp.IsZero() { // never fetched successfully, nothing to expose
+			continue
+		}
+		switch data := r.data.(type) {
+		case *edgecast.BandwidthData:
+			col.bandwidth(ch, r.platform, data)
+		case *edgecast.ConnectionData:
+			col.connections(ch, r.platform, data)
+		case *edgecast.CacheStatusData:
+			col.cachestatus(ch, r.platform, data)
+		case *edgecast.StatusCodeData:
+			col.statuscodes(ch, r.platform, data)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(up, prometheus.GaugeValue, upVal, col.account)
 }
 
-// bandwidth() fetches bandwidth metrics from API and pushes them to the channel as a new prometheus const metric
-func (col EdgecastCollector) bandwidth(ch chan<- prometheus.Metric, metricsWaitGroup *sync.WaitGroup, platform int) {
-	defer metricsWaitGroup.Done()
-
-	bw, err := col.ec.Bandwidth(platform)
-	if err == nil {
-		bwBps := bw.Bps
-		bwPlatform := Platforms[bw.Platform]
-		ch <- prometheus.MustNewConstMetric(bandwidth, prometheus.GaugeValue, bwBps, []string{bwPlatform}...)
+// scrapeContext derives the context of a scrape from its HTTP request
+// - it is cancelled when Prometheus aborts the request or shortly before the X-Prometheus-Scrape-Timeout-Seconds header's timeout
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	seconds, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64)
+	if err != nil || seconds <= 0 {
+		return context.WithCancel(r.Context())
 	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > scrapeTimeoutOffset {
+		timeout -= scrapeTimeoutOffset
+	}
+	return context.WithTimeout(r.Context(), timeout)
 }
 
-// connections() fetches connection metrics from API and pushes them to the channel as a new prometheus const metric
-func (col EdgecastCollector) connections(ch chan<- prometheus.Metric, metricsWaitGroup *sync.WaitGroup, platform int) {
-	defer metricsWaitGroup.Done()
+// EdgecastCollectors bundles the collectors of several accounts, so they can be registered to prometheus at once
+type EdgecastCollectors []*EdgecastCollector
 
-	con, err := col.ec.Connections(platform)
-	if err == nil {
-		conCon := con.Connections
-		conPlatform := Platforms[con.Platform]
-		ch <- prometheus.MustNewConstMetric(connections, prometheus.GaugeValue, conCon, []string{conPlatform}...)
+// Describe describes all metrics exported by the bundled collectors
+// - implements function of interface prometheus.Collector
+func (cols EdgecastCollectors) Describe(ch chan<- *prometheus.Desc) {
+	for _, col := range cols {
+		col.Describe(ch)
 	}
 }
 
-// cachestatus() fetches cachestatus metrics from API and pushes them to the channel as a new prometheus const metric
-func (col EdgecastCollector) cachestatus(ch chan<- prometheus.Metric, metricsWaitGroup *sync.WaitGroup, platform int) {
-	defer metricsWaitGroup.Done()
+// Collect concurrently collects the metrics of all bundled collectors
+// - implements function of interface prometheus.Collector
+func (cols EdgecastCollectors) Collect(ch chan<- prometheus.Metric) {
+	var collectWaitGroup sync.WaitGroup
+	for _, col := range cols {
+		collectWaitGroup.Add(1)
+		go func(col *EdgecastCollector) {
+			defer collectWaitGroup.Done()
+			col.Collect(ch)
+		}(col)
+	}
+	collectWaitGroup.Wait()
+}
 
-	cs, err := col.ec.CacheStatus(platform)
-	if err == nil {
-		csList := *cs
-		var val float64
-		var labelVals []string
-		for c := range csList {
-			val = float64(csList[c].Connections)
-			labelVals = []string{Platforms[platform], csList[c].CacheStatus}
-			ch <- prometheus.MustNewConstMetric(cachestatus, prometheus.GaugeValue, val, labelVals...)
+// fetch() concurrently fetches the selected metric types of all selected platforms
+func fetch(ctx context.Context, ec EdgecastInterface, selection metricSelection) []fetchResult {
+	resultCh := make(chan fetchResult)
+	var fetchWaitGroup sync.WaitGroup
+	for p, metrics := range selection { // for each selected platform concurrently
+		for _, m := range metrics { // fetch all requested metric types concurrently
+			fetchWaitGroup.Add(1)
+			go func(platform int, metric string) {
+				defer fetchWaitGroup.Done()
+				resultCh <- fetchMetric(ctx, ec, platform, metric)
+			}(p, m)
 		}
+	}
+	go func() {
+		fetchWaitGroup.Wait() // wait for metric-fetching to finish
+		close(resultCh)
+	}()
+
+	var results []fetchResult
+	for r := range resultCh {
+		results = append(results, r)
+	}
+	return results
+}
 
+// fetchMetric() fetches a single metric type for a single platform from the API
+func fetchMetric(ctx context.Context, ec EdgecastInterface, platform int, metric string) fetchResult {
+	r := fetchResult{platform: platform, metric: metric}
+	begin := time.Now()
+	switch metric {
+	case metricBandwidth:
+		r.data, r.err = ec.Bandwidth(ctx, platform)
+	case metricConnections:
+		r.data, r.err = ec.Connections(ctx, platform)
+	case metricCacheStatus:
+		r.data, r.err = ec.CacheStatus(ctx, platform)
+	case metricStatusCodes:
+		r.data, r.err = ec.StatusCodes(ctx, platform)
 	}
+	r.fetched = time.Now()
+	r.duration = r.fetched.Sub(begin)
+	if r.err == nil {
+		r.timestamp = r.fetched
+	}
+	return r
+}
 
+// bandwidth() pushes fetched bandwidth metrics to the channel as a new prometheus const metric
+func (col EdgecastCollector) bandwidth(ch chan<- prometheus.Metric, platform int, bw *edgecast.BandwidthData) {
+	ch <- prometheus.MustNewConstMetric(bandwidth, prometheus.GaugeValue, bw.Bps, col.account, Platforms[platform])
+	if col.opts.legacyNames {
+		ch <- prometheus.MustNewConstMetric(legacyBandwidth, prometheus.GaugeValue, bw.Bps, col.account, Platforms[platform])
+	}
 }
 
-// statuscodes() fetches statuscodes metrics from API and pushes them to the channel as a new prometheus const metric
-func (col EdgecastCollector) statuscodes(ch chan<- prometheus.Metric, metricsWaitGroup *sync.WaitGroup, platform int) {
-	defer metricsWaitGroup.Done()
+// connections() pushes fetched connection metrics to the channel as a new prometheus const metric
+func (col EdgecastCollector) connections(ch chan<- prometheus.Metric, platform int, con *edgecast.ConnectionData) {
+	ch <- prometheus.MustNewConstMetric(connections, prometheus.GaugeValue, con.Connections, col.account, Platforms[platform])
+	if col.opts.legacyNames {
+		ch <- prometheus.MustNewConstMetric(legacyConnections, prometheus.GaugeValue, con.Connections, col.account, Platforms[platform])
+	}
+}
 
-	sc, err := col.ec.StatusCodes(platform)
-	if err == nil {
-		scList := *sc
-		var val float64
-		var labelVals []string
-		for s := range scList {
-			val = float64(scList[s].Connections)
-			labelVals = []string{Platforms[platform], scList[s].StatusCode}
-			ch <- prometheus.MustNewConstMetric(statuscodes, prometheus.GaugeValue, val, labelVals...)
+// cachestatus() pushes fetched cachestatus metrics to the channel as new prometheus const metrics
+func (col EdgecastCollector) cachestatus(ch chan<- prometheus.Metric, platform int, cs *edgecast.CacheStatusData) {
+	for _, entry := range *cs {
+		val := float64(entry.Connections)
+		ch <- prometheus.MustNewConstMetric(cacheStatus, prometheus.GaugeValue, val, col.account, Platforms[platform], entry.CacheStatus)
+		if col.opts.legacyNames {
+			ch <- prometheus.MustNewConstMetric(legacyCacheStatus, prometheus.GaugeValue, val, col.account, Platforms[platform], entry.CacheStatus)
 		}
 	}
+	col.cacheClasses(ch, platform, cs)
+}
+
+// statuscodes() pushes fetched statuscodes metrics to the channel as new prometheus const metrics
+func (col EdgecastCollector) statuscodes(ch chan<- prometheus.Metric, platform int, sc *edgecast.StatusCodeData) {
+	for _, entry := range *sc {
+		val := float64(entry.Connections)
+		ch <- prometheus.MustNewConstMetric(statusCodes, prometheus.GaugeValue, val, col.account, Platforms[platform], entry.StatusCode, statusClass(entry.StatusCode))
+		if col.opts.legacyNames {
+			ch <- prometheus.MustNewConstMetric(legacyStatusCodes, prometheus.GaugeValue, val, col.account, Platforms[platform], entry.StatusCode)
+		}
+	}
+	if col.opts.statusClasses {
+		col.statusClasses(ch, platform, sc)
+	}
+	col.errorRatios(ch, platform, sc)
+}
+
+// statusClass() returns the class ("1xx" to "5xx") of an exact status code like "404" or a class like "4xx" returned by the API,
+// "other" for anything else
+func statusClass(code string) string {
+	if len(code) != 3 || code[0] < '1' || code[0] > '5' {
+		return "other"
+	}
+	if code[1:] != "xx" && (code[1] < '0' || code[1] > '9' || code[2] < '0' || code[2] > '9') {
+		return "other"
+	}
+	return code[:1] + "xx"
 }
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/trivago/exporter-edgecast/edgecast"
+)
+
+// fixtureService implements EdgecastInterface by answering every call with the fixtures in testing/fixtures
+type fixtureService struct {
+	t *testing.T
+}
+
+// decode reads the given fixture into data
+func (s fixtureService) decode(name string, data interface{}) {
+	s.t.Helper()
+	body, err := ioutil.ReadFile(filepath.Join("testing", "fixtures", name))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if err := json.Unmarshal(body, data); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s fixtureService) Bandwidth(ctx context.Context, platform int) (*edgecast.BandwidthData, error) {
+	var raw edgecast.RawEdgecastResult
+	s.decode("bandwidth.json", &raw)
+	return &edgecast.BandwidthData{Bps: raw.Result, Platform: platform}, nil
+}
+
+func (s fixtureService) Connections(ctx context.Context, platform int) (*edgecast.ConnectionData, error) {
+	var raw edgecast.RawEdgecastResult
+	s.decode("connections.json", &raw)
+	return &edgecast.ConnectionData{Connections: raw.Result, Platform: platform}, nil
+}
+
+func (s fixtureService) CacheStatus(ctx context.Context, platform int) (*edgecast.CacheStatusData, error) {
+	var data edgecast.CacheStatusData
+	s.decode("cachestatus.json", &data)
+	return &data, nil
+}
+
+func (s fixtureService) StatusCodes(ctx context.Context, platform int) (*edgecast.StatusCodeData, error) {
+	var data edgecast.StatusCodeData
+	s.decode("statuscodes.json", &data)
+	return &data, nil
+}
+
+func (s fixtureService) DataTransferred(ctx context.Context, platform int, period edgecast.ReportPeriod) (*edgecast.DataTransferData, error) {
+	var data edgecast.DataTransferData
+	s.decode("datatransferred.json", &data)
+	return &data, nil
+}
+
+func (s fixtureService) CNAMEReport(ctx context.Context, platform int, period edgecast.ReportPeriod) (*edgecast.TrafficReportData, error) {
+	var data edgecast.TrafficReportData
+	s.decode("cnamereport.json", &data)
+	return &data, nil
+}
+
+func (s fixtureService) OriginReport(ctx context.Context, platform int, period edgecast.ReportPeriod) (*edgecast.TrafficReportData, error) {
+	var data edgecast.TrafficReportData
+	s.decode("originreport.json", &data)
+	return &data, nil
+}
+
+func (s fixtureService) PurgeRequests(ctx context.Context, since time.Time) (*edgecast.PurgeRequestData, error) {
+	var page struct{ Items edgecast.PurgeRequestData }
+	s.decode("purgerequests.json", &page)
+	return &page.Items, nil
+}
+
+func (s fixtureService) Purge(ctx context.Context, platform int, path string) (*edgecast.PurgeData, error) {
+	return &edgecast.PurgeData{ID: "5c4e6b4f1e8a"}, nil
+}
+
+// newFixtureCollector creates a collector of the given metric types of http_large served from the fixtures
+func newFixtureCollector(t *testing.T, metrics []string, opts collectorOptions) *EdgecastCollector {
+	var svc EdgecastInterface = fixtureService{t}
+	return NewEdgecastCollector(context.Background(), "main", &svc, metricSelection{3: metrics}, opts)
+}
+
+func TestStatusClass(t *testing.T) {
+	tests := map[string]string{
+		"2xx":   "2xx",
+		"304":   "3xx",
+		"404":   "4xx",
+		"5xx":   "5xx",
+		"101":   "1xx",
+		"other": "other",
+		"6xx":   "other",
+		"40x":   "other",
+		"4XX":   "other",
+		"":      "other",
+	}
+	for code, want := range tests {
+		if got := statusClass(code); got != want {
+			t.Errorf("statusClass(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestStatusCodeClasses(t *testing.T) {
+	col := newFixtureCollector(t, []string{metricStatusCodes}, collectorOptions{statusClasses: true})
+
+	want := `
+# HELP edgecast_status_code_connections Current connections per platform and HTTP status code (or class of status codes).
+# TYPE edgecast_status_code_connections gauge
+edgecast_status_code_connections{account="main",platform="http_large",status_class="2xx",status_code="2xx"} 222
+edgecast_status_code_connections{account="main",platform="http_large",status_class="3xx",status_code="304"} 304
+edgecast_status_code_connections{account="main",platform="http_large",status_class="3xx",status_code="3xx"} 333
+edgecast_status_code_connections{account="main",platform="http_large",status_class="4xx",status_code="403"} 403
+edgecast_status_code_connections{account="main",platform="http_large",status_class="4xx",status_code="404"} 404
+edgecast_status_code_connections{account="main",platform="http_large",status_class="4xx",status_code="4xx"} 444
+edgecast_status_code_connections{account="main",platform="http_large",status_class="5xx",status_code="5xx"} 555
+edgecast_status_code_connections{account="main",platform="http_large",status_class="other",status_code="other"} 999
+# HELP edgecast_status_class_connections Current connections per platform and class of HTTP status codes, summing up exact codes and classes.
+# TYPE edgecast_status_class_connections gauge
+edgecast_status_class_connections{account="main",class="1xx",platform="http_large"} 0
+edgecast_status_class_connections{account="main",class="2xx",platform="http_large"} 222
+edgecast_status_class_connections{account="main",class="3xx",platform="http_large"} 637
+edgecast_status_class_connections{account="main",class="4xx",platform="http_large"} 1251
+edgecast_status_class_connections{account="main",class="5xx",platform="http_large"} 555
+`
+	err := testutil.CollectAndCompare(col, strings.NewReader(want), "edgecast_status_code_connections", "edgecast_status_class_connections")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStatusClassesDisabled(t *testing.T) {
+	col := newFixtureCollector(t, []string{metricStatusCodes}, collectorOptions{})
+
+	if n := testutil.CollectAndCount(col, "edgecast_status_class_connections"); n != 0 {
+		t.Errorf("collected %d series of edgecast_status_class_connections, want none", n)
+	}
+	if n := testutil.CollectAndCount(col, "edgecast_status_code_connections"); n != 8 {
+		t.Errorf("collected %d series of edgecast_status_code_connections, want 8", n)
+	}
+}
+
+func TestErrorRatio(t *testing.T) {
+	col := newFixtureCollector(t, []string{metricStatusCodes}, collectorOptions{})
+
+	// all connections: 222 + 304 + 333 + 403 + 404 + 444 + 555 + 999 = 3664
+	want := `
+# HELP edgecast_error_ratio Ratio of connections with 4xx or 5xx status codes to all connections per platform.
+# TYPE edgecast_error_ratio gauge
+edgecast_error_ratio{account="main",class="4xx",platform="http_large"} 0.3414301310043668
+edgecast_error_ratio{account="main",class="5xx",platform="http_large"} 0.15147379912663755
+`
+	if err := testutil.CollectAndCompare(col, strings.NewReader(want), "edgecast_error_ratio"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCacheClasses(t *testing.T) {
+	cfg := DefaultConfig()
+	col := newFixtureCollector(t, []string{metricCacheStatus}, cfg.collectorOptions())
+
+	// hit: 1 + 2, miss: 3 + 4 + 5, uncacheable: 7 + 8, other: NONE
+	want := `
+# HELP edgecast_cache_class_connections Current connections per platform and class of cache statuses (hit, miss, uncacheable, other).
+# TYPE edgecast_cache_class_connections gauge
+edgecast_cache_class_connections{account="main",class="hit",platform="http_large"} 3
+edgecast_cache_class_connections{account="main",class="miss",platform="http_large"} 12
+edgecast_cache_class_connections{account="main",class="other",platform="http_large"} 6
+edgecast_cache_class_connections{account="main",class="uncacheable",platform="http_large"} 15
+# HELP edgecast_cache_hit_ratio Ratio of cache hits to cache hits and misses per platform.
+# TYPE edgecast_cache_hit_ratio gauge
+edgecast_cache_hit_ratio{account="main",platform="http_large"} 0.2
+`
+	err := testutil.CollectAndCompare(col, strings.NewReader(want), "edgecast_cache_class_connections", "edgecast_cache_hit_ratio")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCustomCacheClasses(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CacheStatusClasses = map[string][]string{"hit": {"TCP_HIT"}, "miss": {"TCP_MISS", "TCP_EXPIRED_HIT"}}
+	col := newFixtureCollector(t, []string{metricCacheStatus}, cfg.collectorOptions())
+
+	// hit: 1, miss: 3 + 2, uncacheable: none listed, other: 4 + 5 + 6 + 7 + 8
+	want := `
+# HELP edgecast_cache_class_connections Current connections per platform and class of cache statuses (hit, miss, uncacheable, other).
+# TYPE edgecast_cache_class_connections gauge
+edgecast_cache_class_connections{account="main",class="hit",platform="http_large"} 1
+edgecast_cache_class_connections{account="main",class="miss",platform="http_large"} 5
+edgecast_cache_class_connections{account="main",class="other",platform="http_large"} 30
+edgecast_cache_class_connections{account="main",class="uncacheable",platform="http_large"} 0
+# HELP edgecast_cache_hit_ratio Ratio of cache hits to cache hits and misses per platform.
+# TYPE edgecast_cache_hit_ratio gauge
+edgecast_cache_hit_ratio{account="main",platform="http_large"} 0.16666666666666666
+`
+	err := testutil.CollectAndCompare(col, strings.NewReader(want), "edgecast_cache_class_connections", "edgecast_cache_hit_ratio")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// failingService fails to fetch the bandwidth of a single platform and answers everything else with the fixtures
+type failingService struct {
+	fixtureService
+	platform int
+}
+
+func (s failingService) Bandwidth(ctx context.Context, platform int) (*edgecast.BandwidthData, error) {
+	if platform == s.platform {
+		return nil, &edgecast.ServerError{StatusCode: http.StatusBadGateway}
+	}
+	return s.fixtureService.Bandwidth(ctx, platform)
+}
+
+func TestScrapeSuccess(t *testing.T) {
+	var svc EdgecastInterface = failingService{fixtureService{t}, 8}
+	selection := metricSelection{3: {metricBandwidth, metricConnections}, 8: {metricBandwidth, metricConnections}}
+	col := NewEdgecastCollector(context.Background(), "main", &svc, selection, collectorOptions{})
+
+	want := `
+# HELP edgecast_scrape_success Whether the last fetch from the Edgecast API succeeded per platform and metric type.
+# TYPE edgecast_scrape_success gauge
+edgecast_scrape_success{account="main",metric="bandwidth",platform="http_large"} 1
+edgecast_scrape_success{account="main",metric="bandwidth",platform="http_small"} 0
+edgecast_scrape_success{account="main",metric="connections",platform="http_large"} 1
+edgecast_scrape_success{account="main",metric="connections",platform="http_small"} 1
+# HELP edgecast_up Whether the last fetch from the Edgecast API succeeded for at least one platform and metric type.
+# TYPE edgecast_up gauge
+edgecast_up{account="main"} 1
+# HELP edgecast_bandwidth_bits_per_second Current bandwidth usage per platform in bits per second.
+# TYPE edgecast_bandwidth_bits_per_second gauge
+edgecast_bandwidth_bits_per_second{account="main",platform="http_large"} 42.42
+`
+	err := testutil.CollectAndCompare(col, strings.NewReader(want), "edgecast_scrape_success", "edgecast_up", "edgecast_bandwidth_bits_per_second")
+	if err != nil {
+		t.Error(err)
+	}
+	// the duration is exposed for failed fetches as well
+	if n := testutil.CollectAndCount(col, "edgecast_scrape_duration_seconds"); n != 4 {
+		t.Errorf("collected %d series of edgecast_scrape_duration_seconds, want 4", n)
+	}
+
+	// up only drops once every fetch failed
+	col = NewEdgecastCollector(context.Background(), "main", &svc, metricSelection{8: {metricBandwidth}}, collectorOptions{})
+	want = `
+# HELP edgecast_up Whether the last fetch from the Edgecast API succeeded for at least one platform and metric type.
+# TYPE edgecast_up gauge
+edgecast_up{account="main"} 0
+`
+	if err := testutil.CollectAndCompare(col, strings.NewReader(want), "edgecast_up"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLegacyNames(t *testing.T) {
+	cfg := DefaultConfig()
+	if errs := cfg.parse([]byte("legacy_metric_names: true\n")); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	col := newFixtureCollector(t, metricTypes, cfg.collectorOptions())
+
+	// every fetched metric is exposed under its new and its legacy name
+	want := `
+# HELP edgecast_bandwidth_bits_per_second Current bandwidth usage per platform in bits per second.
+# TYPE edgecast_bandwidth_bits_per_second gauge
+edgecast_bandwidth_bits_per_second{account="main",platform="http_large"} 42.42
+# HELP Edgecast_metrics_bandwidth_bps Current amount of bandwidth usage per platform (bits per second).
+# TYPE Edgecast_metrics_bandwidth_bps gauge
+Edgecast_metrics_bandwidth_bps{account="main",platform="http_large"} 42.42
+# HELP edgecast_connections Current active connections per platform.
+# TYPE edgecast_connections gauge
+edgecast_connections{account="main",platform="http_large"} 1234.1234
+# HELP Edgecast_metrics_connections Total active connections per second per platform.
+# TYPE Edgecast_metrics_connections gauge
+Edgecast_metrics_connections{account="main",platform="http_large"} 1234.1234
+# HELP edgecast_cache_status_connections Current connections per platform and cache status.
+# TYPE edgecast_cache_status_connections gauge
+edgecast_cache_status_connections{account="main",cache_status="CONFIG_NOCACHE",platform="http_large"} 7
+edgecast_cache_status_connections{account="main",cache_status="NONE",platform="http_large"} 6
+edgecast_cache_status_connections{account="main",cache_status="TCP_CLIENT_REFRESH_MISS",platform="http_large"} 5
+edgecast_cache_status_connections{account="main",cache_status="TCP_EXPIRED_HIT",platform="http_large"} 2
+edgecast_cache_status_connections{account="main",cache_status="TCP_EXPIRED_MISS",platform="http_large"} 4
+edgecast_cache_status_connections{account="main",cache_status="TCP_HIT",platform="http_large"} 1
+edgecast_cache_status_connections{account="main",cache_status="TCP_MISS",platform="http_large"} 3
+edgecast_cache_status_connections{account="main",cache_status="UNCACHEABLE",platform="http_large"} 8
+# HELP Edgecast_metrics_cachestatus Breakdown of the cache statuses currently being returned for requests to CDN account.
+# TYPE Edgecast_metrics_cachestatus gauge
+Edgecast_metrics_cachestatus{CacheStatus="CONFIG_NOCACHE",account="main",platform="http_large"} 7
+Edgecast_metrics_cachestatus{CacheStatus="NONE",account="main",platform="http_large"} 6
+Edgecast_metrics_cachestatus{CacheStatus="TCP_CLIENT_REFRESH_MISS",account="main",platform="http_large"} 5
+Edgecast_metrics_cachestatus{CacheStatus="TCP_EXPIRED_HIT",account="main",platform="http_large"} 2
+Edgecast_metrics_cachestatus{CacheStatus="TCP_EXPIRED_MISS",account="main",platform="http_large"} 4
+Edgecast_metrics_cachestatus{CacheStatus="TCP_HIT",account="main",platform="http_large"} 1
+Edgecast_metrics_cachestatus{CacheStatus="TCP_MISS",account="main",platform="http_large"} 3
+Edgecast_metrics_cachestatus{CacheStatus="UNCACHEABLE",account="main",platform="http_large"} 8
+# HELP Edgecast_metrics_statuscodes Breakdown of the HTTP status codes currently being returned for requests to CDN account.
+# TYPE Edgecast_metrics_statuscodes gauge
+Edgecast_metrics_statuscodes{StatusCode="2xx",account="main",platform="http_large"} 222
+Edgecast_metrics_statuscodes{StatusCode="304",account="main",platform="http_large"} 304
+Edgecast_metrics_statuscodes{StatusCode="3xx",account="main",platform="http_large"} 333
+Edgecast_metrics_statuscodes{StatusCode="403",account="main",platform="http_large"} 403
+Edgecast_metrics_statuscodes{StatusCode="404",account="main",platform="http_large"} 404
+Edgecast_metrics_statuscodes{StatusCode="4xx",account="main",platform="http_large"} 444
+Edgecast_metrics_statuscodes{StatusCode="5xx",account="main",platform="http_large"} 555
+Edgecast_metrics_statuscodes{StatusCode="other",account="main",platform="http_large"} 999
+`
+	names := []string{
+		"edgecast_bandwidth_bits_per_second", "Edgecast_metrics_bandwidth_bps",
+		"edgecast_connections", "Edgecast_metrics_connections",
+		"edgecast_cache_status_connections", "Edgecast_metrics_cachestatus",
+		"Edgecast_metrics_statuscodes",
+	}
+	if err := testutil.CollectAndCompare(col, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(col, "edgecast_status_code_connections"); n != 8 {
+		t.Errorf("collected %d series of edgecast_status_code_connections next to the legacy names, want 8", n)
+	}
+
+	// --metrics.legacy-names enables them as well, and without either only the new names are exposed
+	defer func(prev bool) { *metricsLegacyNames = prev }(*metricsLegacyNames)
+	*metricsLegacyNames = true
+	cfg = DefaultConfig()
+	cfg.applyFlags()
+	if !cfg.collectorOptions().legacyNames {
+		t.Error("--metrics.legacy-names didn't enable the legacy names")
+	}
+	col = newFixtureCollector(t, metricTypes, collectorOptions{})
+	for _, name := range []string{"Edgecast_metrics_bandwidth_bps", "Edgecast_metrics_connections", "Edgecast_metrics_cachestatus", "Edgecast_metrics_statuscodes"} {
+		if n := testutil.CollectAndCount(col, name); n != 0 {
+			t.Errorf("collected %d series of %s without legacy names, want none", n, name)
+		}
+	}
+}
+
+func TestMetricSelection(t *testing.T) {
+	var svc EdgecastInterface = fixtureService{t}
+	selection := metricSelection{3: {metricBandwidth}, 14: {metricBandwidth, metricConnections}}
+	col := NewEdgecastCollector(context.Background(), "main", &svc, selection, collectorOptions{})
+
+	descs := make(chan *prometheus.Desc, 32)
+	col.Describe(descs)
+	close(descs)
+	for desc := range descs {
+		for _, unselected := range []*prometheus.Desc{cacheStatus, cacheClassConnections, statusCodes, errorRatio} {
+			if desc == unselected {
+				t.Errorf("described %s, although neither cachestatus nor statuscodes are selected", desc)
+			}
+		}
+	}
+
+	if n := testutil.CollectAndCount(col, "edgecast_bandwidth_bits_per_second"); n != 2 {
+		t.Errorf("collected %d series of edgecast_bandwidth_bits_per_second, want 2", n)
+	}
+	if n := testutil.CollectAndCount(col, "edgecast_connections"); n != 1 {
+		t.Errorf("collected %d series of edgecast_connections, want 1 (adn only)", n)
+	}
+	if n := testutil.CollectAndCount(col, "edgecast_scrape_success"); n != 3 {
+		t.Errorf("collected %d series of edgecast_scrape_success, want 3", n)
+	}
+}
+
+func TestConfigMetrics(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PlatformMetrics = map[string][]string{"adn": {metricBandwidth}, "2": {}}
+	platforms := map[int]string{2: "flash", 3: "http_large", 14: "adn"}
+
+	got := cfg.metrics(AccountConfig{}, platforms)
+	want := metricSelection{3: metricTypes, 14: {metricBandwidth}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("metrics() = %v, want %v", got, want)
+	}
+
+	account := AccountConfig{Metrics: []string{metricConnections}, PlatformMetrics: map[string][]string{"flash": {metricConnections}, "14": {metricStatusCodes}}}
+	got = cfg.metrics(account, platforms)
+	want = metricSelection{2: {metricConnections}, 3: {metricConnections}, 14: {metricStatusCodes}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("metrics() of account = %v, want %v", got, want)
+	}
+
+	if errs := validatePlatformMetrics("platform_metrics", map[string][]string{"adn": {"bandwith"}, "14": nil, "foo": nil}); len(errs) != 3 {
+		t.Errorf("validatePlatformMetrics() = %q, want 3 errors", errs)
+	}
+}
+
+func TestScrapeContext(t *testing.T) {
+	tests := []struct {
+		header  string
+		timeout time.Duration // 0 for no deadline
+	}{
+		{"10", 9500 * time.Millisecond},
+		{"2.5", 2 * time.Second},
+		{"0.3", 300 * time.Millisecond}, // shorter than the offset, so it is kept
+		{"", 0},
+		{"ten", 0},
+		{"0", 0},
+		{"-5", 0},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/probe", nil)
+		if tt.header != "" {
+			req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", tt.header)
+		}
+		ctx, cancel := scrapeContext(req)
+		deadline, ok := ctx.Deadline()
+		cancel()
+		switch {
+		case tt.timeout == 0 && ok:
+			t.Errorf("header %q: deadline in %s, want none", tt.header, time.Until(deadline))
+		case tt.timeout != 0 && !ok:
+			t.Errorf("header %q: no deadline, want one in %s", tt.header, tt.timeout)
+		case tt.timeout != 0:
+			if left := time.Until(deadline); left > tt.timeout || left < tt.timeout-100*time.Millisecond {
+				t.Errorf("header %q: deadline in %s, want %s", tt.header, left, tt.timeout)
+			}
+		}
+	}
+}
+
+func TestScrapeContextCancellation(t *testing.T) {
+	for _, header := range []string{"", "10"} {
+		parent, abort := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodGet, "/probe", nil).WithContext(parent)
+		if header != "" {
+			req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", header)
+		}
+		ctx, cancel := scrapeContext(req)
+
+		abort() // the client aborted the scrape
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Errorf("header %q: scrape not cancelled after the client aborted", header)
+		}
+		cancel()
+	}
+}
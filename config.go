@@ -0,0 +1,881 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/exporter-toolkit/web"
+	"github.com/trivago/exporter-edgecast/edgecast"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds the complete configuration of the exporter
+// - read from the YAML file given by --config.file, individual keys can be overridden by environment variables
+type Config struct {
+	Accounts  []AccountConfig `yaml:"accounts"`
+	Secrets   []AccountConfig `yaml:"secrets"` // credentials of accounts that are only scraped via /probe, looked up by name
+	Platforms PlatformList    `yaml:"platforms"`
+	Metrics   []string        `yaml:"metrics"`
+
+	DiscoveryTimeout time.Duration `yaml:"discovery_timeout"` // bounds the discovery of the platforms of accounts selecting auto
+	DiscoveryTTL     time.Duration `yaml:"discovery_ttl"`     // how long probes selecting auto reuse the discovered platforms
+
+	PlatformMetrics map[string][]string `yaml:"platform_metrics"` // metric types per platform (ID or name) instead of metrics
+
+	Web       WebConfig       `yaml:"web"`
+	Client    ClientConfig    `yaml:"client"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"` // shared by the requests of all accounts
+
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	PollInterval   time.Duration        `yaml:"poll_interval"`
+	Reporting      ReportingConfig      `yaml:"reporting"`
+	Purges         PurgesConfig         `yaml:"purges"`
+	PurgeAPI       PurgeAPIConfig       `yaml:"purge_api"`
+	Log            LogConfig            `yaml:"log"`
+
+	LegacyMetricNames  bool                `yaml:"legacy_metric_names"`  // additionally expose all metrics under their names before the naming conventions were adopted
+	StatusClasses      bool                `yaml:"status_classes"`       // additionally expose the status codes re-aggregated into the classes 1xx to 5xx
+	CacheStatusClasses map[string][]string `yaml:"cache_status_classes"` // cache statuses per class (hit, miss, uncacheable), all others are of class other
+}
+
+// AccountConfig holds the credentials of an Edgecast customer account
+type AccountConfig struct {
+	ID        string       `yaml:"id"`
+	Token     string       `yaml:"token"`
+	TokenFile string       `yaml:"token_file"` // file holding the token instead of token, read again whenever it changes
+	Name      string       `yaml:"name"`       // friendly name used as account label, defaults to the ID
+	Platforms PlatformList `yaml:"platforms"`  // subset of platforms scraped for this account, defaults to the global platforms
+
+	Metrics         []string            `yaml:"metrics"`          // metric types of this account, default to the global metrics
+	PlatformMetrics map[string][]string `yaml:"platform_metrics"` // metric types of this account per platform (ID or name)
+
+	RateLimit RateLimitConfig `yaml:"rate_limit"` // applies to the requests of this account in addition to the global rate limit
+}
+
+// label returns the value of the account label on every series of this account
+func (a AccountConfig) label() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return a.ID
+}
+
+// WebConfig holds the settings of the HTTP server exposing the metrics
+type WebConfig struct {
+	ListenAddresses []string `yaml:"listen_addresses"`
+	ConfigFile      string   `yaml:"config_file"` // TLS and basic auth settings in the Prometheus web-config format
+
+	ShutdownGracePeriod time.Duration `yaml:"shutdown_grace_period"` // time in-flight requests may take to finish on shutdown
+}
+
+// ClientConfig holds the settings of the client querying the Edgecast API
+type ClientConfig struct {
+	BaseURL        string        `yaml:"base_url"`
+	Timeout        time.Duration `yaml:"timeout"`
+	Retries        int           `yaml:"retries"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	MaxElapsedTime time.Duration `yaml:"max_elapsed_time"`
+
+	RecordDir string `yaml:"record_dir"` // directory every raw response of the Edgecast API is saved to
+	ReplayDir string `yaml:"replay_dir"` // directory of recorded responses served instead of querying the Edgecast API
+}
+
+// retryPolicy returns the policy for retrying failed API requests
+// - retries are additionally bounded by the deadline of the poll or scrape that caused them
+func (c ClientConfig) retryPolicy() edgecast.RetryPolicy {
+	policy := edgecast.DefaultRetryPolicy()
+	policy.MaxAttempts = c.Retries
+	policy.InitialBackoff = c.InitialBackoff
+	policy.MaxBackoff = c.MaxBackoff
+	policy.MaxElapsedTime = c.MaxElapsedTime
+	return policy
+}
+
+// RateLimitConfig holds the limits of requests to the Edgecast API, 0 disables the respective limit
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+	MaxInFlight       int     `yaml:"max_in_flight"`
+}
+
+// limiter creates the limiter enforcing the configured limits
+func (c RateLimitConfig) limiter(name string) *edgecast.Limiter {
+	return edgecast.NewLimiter(name, c.RequestsPerSecond, c.Burst, c.MaxInFlight)
+}
+
+// validate reports every invalid limit with its path
+func (c RateLimitConfig) validate(path string) []string {
+	var errs []string
+	if c.RequestsPerSecond < 0 {
+		errs = append(errs, fmt.Sprintf("%s.requests_per_second: must not be negative, got %g", path, c.RequestsPerSecond))
+	}
+	if c.RequestsPerSecond > 0 && c.Burst < 1 {
+		errs = append(errs, fmt.Sprintf("%s.burst: must be at least 1 if requests_per_second is set, got %d", path, c.Burst))
+	}
+	if c.MaxInFlight < 0 {
+		errs = append(errs, fmt.Sprintf("%s.max_in_flight: must not be negative, got %d", path, c.MaxInFlight))
+	}
+	return errs
+}
+
+// CircuitBreakerConfig holds the settings of the circuit breakers per account, method and platform
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold"` // consecutive failures opening the breaker, 0 disables it
+	OpenTimeout      time.Duration `yaml:"open_timeout"`      // time until an open breaker lets a trial call through
+}
+
+// ReportingConfig holds the settings of fetching the reports of the Edgecast reporting API
+// - reports are polled on their own schedule, which is usually much slower than the one of the real-time statistics
+type ReportingConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	BaseURL      string        `yaml:"base_url"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	Delay        time.Duration `yaml:"delay"`      // time the reporting API takes until the data of an interval is complete
+	Intervals    []string      `yaml:"intervals"`  // hour and/or day
+	CNAMEs       bool          `yaml:"cnames"`     // additionally fetch the traffic per edge CNAME
+	Origins      bool          `yaml:"origins"`    // additionally fetch the traffic per customer origin
+	AllowList    []string      `yaml:"allow_list"` // regular expressions of the exposed edge CNAMEs and customer origins, all are exposed if empty
+}
+
+// reportIntervals maps the names of all supported report intervals to their values
+var reportIntervals = map[string]edgecast.Interval{
+	edgecast.IntervalHour.String(): edgecast.IntervalHour,
+	edgecast.IntervalDay.String():  edgecast.IntervalDay,
+}
+
+// intervals returns the configured report intervals
+func (c ReportingConfig) intervals() []edgecast.Interval {
+	intervals := make([]edgecast.Interval, 0, len(c.Intervals))
+	for _, name := range c.Intervals {
+		intervals = append(intervals, reportIntervals[name])
+	}
+	return intervals
+}
+
+// allowList returns the expression matching the exposed edge CNAMEs and customer origins, nil if all are exposed
+// - every expression is fully anchored, like the regular expressions of Prometheus relabeling
+func (c ReportingConfig) allowList() *regexp.Regexp {
+	if len(c.AllowList) == 0 {
+		return nil
+	}
+	return regexp.MustCompile("^(?:" + strings.Join(c.AllowList, "|") + ")$")
+}
+
+// validate reports every invalid setting with its path, only if fetching reports is enabled
+func (c ReportingConfig) validate(path string) []string {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []string
+	if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Sprintf("%s.base_url: invalid URL %q", path, c.BaseURL))
+	}
+	if c.PollInterval <= 0 {
+		errs = append(errs, fmt.Sprintf("%s.poll_interval: must be positive, got %s", path, c.PollInterval))
+	}
+	if c.Delay < 0 {
+		errs = append(errs, fmt.Sprintf("%s.delay: must not be negative, got %s", path, c.Delay))
+	}
+	if len(c.Intervals) == 0 {
+		errs = append(errs, path+".intervals: at least one interval is required")
+	}
+	for i, name := range c.Intervals {
+		if _, ok := reportIntervals[name]; !ok {
+			errs = append(errs, fmt.Sprintf("%s.intervals[%d]: unknown interval %q, must be one of hour, day", path, i, name))
+		}
+	}
+	for i, expr := range c.AllowList {
+		if _, err := regexp.Compile("^(?:" + expr + ")$"); err != nil {
+			errs = append(errs, fmt.Sprintf("%s.allow_list[%d]: %v", path, i, err))
+		}
+	}
+	return errs
+}
+
+// PurgesConfig holds the settings of tracking the purge requests of every account
+type PurgesConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	BaseURL      string        `yaml:"base_url"` // URL of the media control center API
+	PollInterval time.Duration `yaml:"poll_interval"`
+	Lookback     time.Duration `yaml:"lookback"` // purge requests submitted within this duration are tracked
+}
+
+// validate reports every invalid setting with its path, only if tracking purges is enabled
+func (c PurgesConfig) validate(path string) []string {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []string
+	if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Sprintf("%s.base_url: invalid URL %q", path, c.BaseURL))
+	}
+	if c.PollInterval <= 0 {
+		errs = append(errs, fmt.Sprintf("%s.poll_interval: must be positive, got %s", path, c.PollInterval))
+	}
+	if c.Lookback <= 0 {
+		errs = append(errs, fmt.Sprintf("%s.lookback: must be positive, got %s", path, c.Lookback))
+	}
+	return errs
+}
+
+// PurgeAPIConfig holds the settings of the endpoint submitting purges on behalf of the configured accounts
+type PurgeAPIConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	BearerToken     string `yaml:"bearer_token"`
+	BearerTokenFile string `yaml:"bearer_token_file"` // file holding the bearer token instead of bearer_token, read on every request
+	AuditLogFile    string `yaml:"audit_log_file"`    // file every purge is appended to as JSON line, defaults to stderr
+}
+
+// token returns the bearer token that authorizes the submission of purges
+func (c PurgeAPIConfig) token() (string, error) {
+	if c.BearerTokenFile != "" {
+		return readToken(c.BearerTokenFile)
+	}
+	return c.BearerToken, nil
+}
+
+// validate reports every invalid setting with its path, only if the endpoint is enabled
+// - the endpoint is never served without a bearer token
+func (c PurgeAPIConfig) validate(path string) []string {
+	if !c.Enabled {
+		return nil
+	}
+	switch {
+	case c.BearerToken == "" && c.BearerTokenFile == "":
+		return []string{path + ".bearer_token: must not be empty (or set bearer_token_file)"}
+	case c.BearerToken != "" && c.BearerTokenFile != "":
+		return []string{path + ".bearer_token_file: must not be set together with bearer_token"}
+	case c.BearerTokenFile != "":
+		if _, err := readToken(c.BearerTokenFile); err != nil {
+			return []string{fmt.Sprintf("%s.bearer_token_file: %v", path, err)}
+		}
+	}
+	return nil
+}
+
+// LogConfig holds the settings of the logger
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// ConfigError lists every problem found while loading a configuration, each prefixed with the path of the offending key
+type ConfigError []string
+
+func (e ConfigError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// DefaultConfig returns the configuration used for every key that is neither set in the file nor in the environment
+func DefaultConfig() Config {
+	retry := edgecast.DefaultRetryPolicy()
+	return Config{
+		Metrics: append([]string(nil), metricTypes...),
+		Web:     WebConfig{ListenAddresses: []string{":9599"}, ShutdownGracePeriod: 10 * time.Second},
+		Client: ClientConfig{
+			BaseURL:        edgecast.DefaultBaseURL,
+			Timeout:        edgecast.DefaultRequestTimeout,
+			Retries:        retry.MaxAttempts,
+			InitialBackoff: retry.InitialBackoff,
+			MaxBackoff:     retry.MaxBackoff,
+			MaxElapsedTime: retry.MaxElapsedTime,
+		},
+		RateLimit:      RateLimitConfig{RequestsPerSecond: 5, Burst: 10, MaxInFlight: 8},
+		CircuitBreaker: CircuitBreakerConfig{FailureThreshold: 5, OpenTimeout: time.Minute},
+		PollInterval:   30 * time.Second,
+		Log:            LogConfig{Level: "info", Format: "logfmt"},
+
+		DiscoveryTimeout: 30 * time.Second,
+		DiscoveryTTL:     time.Hour,
+		Reporting: ReportingConfig{
+			BaseURL:      edgecast.DefaultReportingURL,
+			PollInterval: 15 * time.Minute,
+			Delay:        time.Hour,
+			Intervals:    []string{"hour", "day"},
+		},
+		Purges: PurgesConfig{
+			BaseURL:      edgecast.DefaultMCCURL,
+			PollInterval: time.Minute,
+			Lookback:     24 * time.Hour,
+		},
+
+		CacheStatusClasses: defaultCacheStatusClasses(),
+	}
+}
+
+// LoadConfig reads the configuration from the given file (if any), applies the environment and command-line overrides and validates the result
+// - all problems are reported at once in a ConfigError
+func LoadConfig(filename string) (*Config, error) {
+	cfg := DefaultConfig()
+	var errs ConfigError
+
+	if filename != "" {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, cfg.parse(content)...)
+	}
+	errs = append(errs, cfg.applyEnv(os.Getenv)...)
+	cfg.applyFlags()
+	errs = append(errs, cfg.validate()...)
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return &cfg, nil
+}
+
+// parse() decodes the given YAML content on top of the current configuration and reports unknown keys and type mismatches
+func (c *Config) parse(content []byte) []string {
+	var errs []string
+
+	var tree interface{}
+	if err := yaml.Unmarshal(content, &tree); err != nil {
+		return []string{err.Error()}
+	}
+	errs = append(errs, unknownKeys("", tree, reflect.TypeOf(*c))...)
+
+	if err := yaml.Unmarshal(content, c); err != nil {
+		if typeErr, ok := err.(*yaml.TypeError); ok {
+			errs = append(errs, typeErr.Errors...)
+		} else {
+			errs = append(errs, err.Error())
+		}
+	}
+	return errs
+}
+
+// unknownKeys() recursively walks a decoded YAML tree and reports every key without a matching field in the given type
+func unknownKeys(path string, node interface{}, t reflect.Type) []string {
+	var errs []string
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := node.(map[interface{}]interface{})
+		if !ok { // type mismatches are reported by the decoder
+			return nil
+		}
+		fields := make(map[string]reflect.Type, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			fields[name] = t.Field(i).Type
+		}
+		for k, v := range m {
+			key := joinPath(path, fmt.Sprint(k))
+			fieldType, ok := fields[fmt.Sprint(k)]
+			if !ok {
+				errs = append(errs, key+": unknown key")
+				continue
+			}
+			errs = append(errs, unknownKeys(key, v, fieldType)...)
+		}
+	case reflect.Slice:
+		l, ok := node.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, v := range l {
+			errs = append(errs, unknownKeys(fmt.Sprintf("%s[%d]", path, i), v, t.Elem())...)
+		}
+	}
+
+	sort.Strings(errs)
+	return errs
+}
+
+// collectorOptions() returns the settings of how the collectors expose the fetched metrics
+func (c *Config) collectorOptions() collectorOptions {
+	classes := make(map[string]string)
+	for class, statuses := range c.CacheStatusClasses {
+		for _, status := range statuses {
+			classes[status] = class
+		}
+	}
+	return collectorOptions{legacyNames: c.LegacyMetricNames, statusClasses: c.StatusClasses, cacheClasses: classes}
+}
+
+// sortedKeys() returns the keys of the given map in alphabetical order
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// joinPath() appends a key to the dotted path of its parent
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// validateToken() checks that the account has either a token or a readable token file
+func (a AccountConfig) validateToken(path string) []string {
+	switch {
+	case a.Token == "" && a.TokenFile == "":
+		return []string{path + ".token: must not be empty (or set token_file)"}
+	case a.Token != "" && a.TokenFile != "":
+		return []string{path + ".token_file: must not be set together with token"}
+	case a.TokenFile != "":
+		if _, err := readToken(a.TokenFile); err != nil {
+			return []string{fmt.Sprintf("%s.token_file: %v", path, err)}
+		}
+	}
+	return nil
+}
+
+// applyEnv() overrides individual keys with the environment variables that are set
+func (c *Config) applyEnv(getenv func(string) string) []string {
+	var errs []string
+
+	if id := getenv("EDGECAST_ACCOUNT_ID"); id != "" {
+		c.account().ID = id
+	}
+	token, tokenFile := getenv("EDGECAST_TOKEN"), getenv("EDGECAST_TOKEN_FILE")
+	switch {
+	case token != "" && tokenFile != "":
+		errs = append(errs, "EDGECAST_TOKEN_FILE: must not be set together with EDGECAST_TOKEN")
+		c.account().Token, c.account().TokenFile = token, ""
+	case token != "":
+		c.account().Token, c.account().TokenFile = token, ""
+	case tokenFile != "":
+		c.account().Token, c.account().TokenFile = "", tokenFile
+	}
+	if env := getenv("EDGECAST_PLATFORMS"); env != "" {
+		c.Platforms = parsePlatforms(env)
+	}
+	if env := getenv("EDGECAST_METRICS"); env != "" {
+		c.Metrics = strings.Split(env, ",")
+	}
+	if env := getenv("EDGECAST_LISTEN_ADDRESS"); env != "" {
+		c.Web.ListenAddresses = strings.Split(env, ",")
+	}
+	if env := getenv("EDGECAST_WEB_CONFIG_FILE"); env != "" {
+		c.Web.ConfigFile = env
+	}
+	if env := getenv("EDGECAST_BASE_URL"); env != "" {
+		c.Client.BaseURL = env
+	}
+	if env := getenv("EDGECAST_TIMEOUT"); env != "" {
+		d, err := time.ParseDuration(env)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("EDGECAST_TIMEOUT: invalid duration %q", env))
+		} else {
+			c.Client.Timeout = d
+		}
+	}
+	if env := getenv("EDGECAST_RETRIES"); env != "" {
+		i, err := strconv.Atoi(env)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("EDGECAST_RETRIES: invalid number %q", env))
+		} else {
+			c.Client.Retries = i
+		}
+	}
+	if env := getenv("EDGECAST_POLL_INTERVAL"); env != "" {
+		d, err := time.ParseDuration(env)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("EDGECAST_POLL_INTERVAL: invalid duration %q", env))
+		} else {
+			c.PollInterval = d
+		}
+	}
+	if env := getenv("EDGECAST_SHUTDOWN_GRACE_PERIOD"); env != "" {
+		d, err := time.ParseDuration(env)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("EDGECAST_SHUTDOWN_GRACE_PERIOD: invalid duration %q", env))
+		} else {
+			c.Web.ShutdownGracePeriod = d
+		}
+	}
+	if env := getenv("EDGECAST_LOG_LEVEL"); env != "" {
+		c.Log.Level = env
+	}
+	if env := getenv("EDGECAST_LOG_FORMAT"); env != "" {
+		c.Log.Format = env
+	}
+	return errs
+}
+
+// applyFlags() overrides individual keys with the command-line flags that are set
+func (c *Config) applyFlags() {
+	if len(webListenAddresses) > 0 {
+		c.Web.ListenAddresses = webListenAddresses
+	}
+	if *webConfigFile != "" {
+		c.Web.ConfigFile = *webConfigFile
+	}
+	if *metricsLegacyNames {
+		c.LegacyMetricNames = true
+	}
+	if *recordDir != "" {
+		c.Client.RecordDir = *recordDir
+	}
+	if *replayDir != "" {
+		c.Client.ReplayDir = *replayDir
+	}
+}
+
+// account() returns the first configured account, creating it if there is none yet
+// - the single-account environment variables EDGECAST_ACCOUNT_ID, EDGECAST_TOKEN and EDGECAST_TOKEN_FILE apply to it
+func (c *Config) account() *AccountConfig {
+	if len(c.Accounts) == 0 {
+		c.Accounts = append(c.Accounts, AccountConfig{})
+	}
+	return &c.Accounts[0]
+}
+
+// validate() checks the values of all keys and reports every invalid one with its path
+func (c *Config) validate() []string {
+	var errs []string
+
+	if len(c.Accounts) == 0 && len(c.Secrets) == 0 {
+		errs = append(errs, "accounts: at least one account or secret is required (or set EDGECAST_ACCOUNT_ID and EDGECAST_TOKEN)")
+	}
+	labels := make(map[string]int, len(c.Accounts))
+	for i, a := range c.Accounts {
+		if a.ID == "" {
+			errs = append(errs, fmt.Sprintf("accounts[%d].id: must not be empty", i))
+		}
+		errs = append(errs, a.validateToken(fmt.Sprintf("accounts[%d]", i))...)
+		if j, ok := labels[a.label()]; ok {
+			errs = append(errs, fmt.Sprintf("accounts[%d].name: %q is already used by accounts[%d]", i, a.label(), j))
+		}
+		labels[a.label()] = i
+		errs = append(errs, validatePlatforms(fmt.Sprintf("accounts[%d].platforms", i), a.Platforms)...)
+		errs = append(errs, validateMetrics(fmt.Sprintf("accounts[%d].metrics", i), a.Metrics)...)
+		errs = append(errs, validatePlatformMetrics(fmt.Sprintf("accounts[%d].platform_metrics", i), a.PlatformMetrics)...)
+		errs = append(errs, a.RateLimit.validate(fmt.Sprintf("accounts[%d].rate_limit", i))...)
+	}
+
+	names := make(map[string]int, len(c.Secrets))
+	for i, sec := range c.Secrets {
+		if sec.Name == "" {
+			errs = append(errs, fmt.Sprintf("secrets[%d].name: must not be empty", i))
+		} else if j, ok := names[sec.Name]; ok {
+			errs = append(errs, fmt.Sprintf("secrets[%d].name: %q is already used by secrets[%d]", i, sec.Name, j))
+		} else if j, ok := labels[sec.Name]; ok {
+			// limiters, circuit breakers and token files are looked up by name, so the secret would take over those of the account
+			errs = append(errs, fmt.Sprintf("secrets[%d].name: %q is already used by accounts[%d]", i, sec.Name, j))
+		}
+		names[sec.Name] = i
+		if sec.ID == "" {
+			errs = append(errs, fmt.Sprintf("secrets[%d].id: must not be empty", i))
+		}
+		errs = append(errs, sec.validateToken(fmt.Sprintf("secrets[%d]", i))...)
+		errs = append(errs, validatePlatforms(fmt.Sprintf("secrets[%d].platforms", i), sec.Platforms)...)
+		errs = append(errs, validateMetrics(fmt.Sprintf("secrets[%d].metrics", i), sec.Metrics)...)
+		errs = append(errs, validatePlatformMetrics(fmt.Sprintf("secrets[%d].platform_metrics", i), sec.PlatformMetrics)...)
+		errs = append(errs, sec.RateLimit.validate(fmt.Sprintf("secrets[%d].rate_limit", i))...)
+	}
+
+	errs = append(errs, validatePlatforms("platforms", c.Platforms)...)
+
+	if len(c.Metrics) == 0 {
+		errs = append(errs, "metrics: at least one metric type is required")
+	}
+	errs = append(errs, validateMetrics("metrics", c.Metrics)...)
+	errs = append(errs, validatePlatformMetrics("platform_metrics", c.PlatformMetrics)...)
+
+	classes := make(map[string]string)
+	for _, class := range sortedKeys(c.CacheStatusClasses) {
+		if !contains(configurableCacheClasses, class) {
+			errs = append(errs, fmt.Sprintf("cache_status_classes.%s: unknown class, must be one of %s", class, strings.Join(configurableCacheClasses, ", ")))
+			continue
+		}
+		for i, status := range c.CacheStatusClasses[class] {
+			if other, ok := classes[status]; ok {
+				errs = append(errs, fmt.Sprintf("cache_status_classes.%s[%d]: %q is already classified as %s", class, i, status, other))
+			}
+			classes[status] = class
+		}
+	}
+
+	if len(c.Web.ListenAddresses) == 0 {
+		errs = append(errs, "web.listen_addresses: at least one address is required")
+	}
+	for i, addr := range c.Web.ListenAddresses {
+		if addr == "" {
+			errs = append(errs, fmt.Sprintf("web.listen_addresses[%d]: must not be empty", i))
+		}
+	}
+	if c.Web.ConfigFile != "" {
+		if err := web.Validate(c.Web.ConfigFile); err != nil {
+			errs = append(errs, fmt.Sprintf("web.config_file: %v", err))
+		}
+	}
+	if c.Web.ShutdownGracePeriod < 0 {
+		errs = append(errs, fmt.Sprintf("web.shutdown_grace_period: must not be negative, got %s", c.Web.ShutdownGracePeriod))
+	}
+	if u, err := url.Parse(c.Client.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Sprintf("client.base_url: invalid URL %q", c.Client.BaseURL))
+	}
+	if c.Client.Timeout <= 0 {
+		errs = append(errs, fmt.Sprintf("client.timeout: must be positive, got %s", c.Client.Timeout))
+	}
+	if c.Client.Retries < 1 {
+		errs = append(errs, fmt.Sprintf("client.retries: must be at least 1, got %d", c.Client.Retries))
+	}
+	if c.Client.InitialBackoff <= 0 {
+		errs = append(errs, fmt.Sprintf("client.initial_backoff: must be positive, got %s", c.Client.InitialBackoff))
+	}
+	if c.Client.MaxBackoff < c.Client.InitialBackoff {
+		errs = append(errs, fmt.Sprintf("client.max_backoff: must not be less than client.initial_backoff, got %s", c.Client.MaxBackoff))
+	}
+	if c.Client.MaxElapsedTime < 0 {
+		errs = append(errs, fmt.Sprintf("client.max_elapsed_time: must not be negative, got %s", c.Client.MaxElapsedTime))
+	}
+	if c.Client.RecordDir != "" && c.Client.ReplayDir != "" {
+		errs = append(errs, "client.replay_dir: must not be set together with client.record_dir")
+	}
+	if c.Client.ReplayDir != "" {
+		if info, err := os.Stat(c.Client.ReplayDir); err != nil {
+			errs = append(errs, fmt.Sprintf("client.replay_dir: %v", err))
+		} else if !info.IsDir() {
+			errs = append(errs, fmt.Sprintf("client.replay_dir: %s is not a directory", c.Client.ReplayDir))
+		}
+	}
+	errs = append(errs, c.RateLimit.validate("rate_limit")...)
+	if c.CircuitBreaker.FailureThreshold < 0 {
+		errs = append(errs, fmt.Sprintf("circuit_breaker.failure_threshold: must not be negative, got %d", c.CircuitBreaker.FailureThreshold))
+	}
+	if c.CircuitBreaker.FailureThreshold > 0 && c.CircuitBreaker.OpenTimeout <= 0 {
+		errs = append(errs, fmt.Sprintf("circuit_breaker.open_timeout: must be positive, got %s", c.CircuitBreaker.OpenTimeout))
+	}
+	if c.PollInterval <= 0 {
+		errs = append(errs, fmt.Sprintf("poll_interval: must be positive, got %s", c.PollInterval))
+	}
+	if c.DiscoveryTimeout <= 0 {
+		errs = append(errs, fmt.Sprintf("discovery_timeout: must be positive, got %s", c.DiscoveryTimeout))
+	}
+	if c.DiscoveryTTL <= 0 {
+		errs = append(errs, fmt.Sprintf("discovery_ttl: must be positive, got %s", c.DiscoveryTTL))
+	}
+	errs = append(errs, c.Reporting.validate("reporting")...)
+	errs = append(errs, c.Purges.validate("purges")...)
+	errs = append(errs, c.PurgeAPI.validate("purge_api")...)
+
+	if !contains([]string{"debug", "info", "warn", "error"}, c.Log.Level) {
+		errs = append(errs, fmt.Sprintf("log.level: unknown level %q, must be one of debug, info, warn, error", c.Log.Level))
+	}
+	if !contains([]string{"logfmt", "json"}, c.Log.Format) {
+		errs = append(errs, fmt.Sprintf("log.format: unknown format %q, must be one of logfmt, json", c.Log.Format))
+	}
+	return errs
+}
+
+// target() looks up the credentials of the account with the given name, first in the secrets and then in the accounts
+func (c *Config) target(name string) (AccountConfig, bool) {
+	for _, sec := range c.Secrets {
+		if sec.Name == name {
+			return sec, true
+		}
+	}
+	for _, a := range c.Accounts {
+		if a.label() == name {
+			return a, true
+		}
+	}
+	return AccountConfig{}, false
+}
+
+// PlatformList holds platforms given by ID (e.g. 3) or name (e.g. http_large),
+// or the single entry "auto" to scrape the platforms an account is subscribed to
+// - in YAML, it is given as list or as comma-separated string
+type PlatformList []string
+
+// platformsAuto is the entry of a PlatformList that discovers the platforms of an account
+const platformsAuto = "auto"
+
+// UnmarshalYAML decodes a list of platforms or a comma-separated string like the EDGECAST_PLATFORMS variable
+func (l *PlatformList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*l = list
+		return nil
+	}
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	*l = parsePlatforms(s)
+	return nil
+}
+
+// auto() reports whether the platforms of an account have to be discovered
+func (l PlatformList) auto() bool {
+	return len(l) == 1 && l[0] == platformsAuto
+}
+
+// ids() returns the IDs of all known platforms in the list
+func (l PlatformList) ids() []int {
+	ids := make([]int, 0, len(l))
+	for _, p := range l {
+		if id, ok := platformID(p); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// platformID() returns the ID of a platform given by ID or name
+func platformID(platform string) (int, bool) {
+	if id, err := strconv.Atoi(platform); err == nil {
+		_, ok := Platforms[id]
+		return id, ok
+	}
+	for id, name := range Platforms {
+		if name == platform {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// parsePlatforms() parses a comma-separated list of platform IDs or names
+func parsePlatforms(list string) PlatformList {
+	var platforms PlatformList
+	for _, s := range strings.Split(list, ",") {
+		platforms = append(platforms, strings.TrimSpace(s))
+	}
+	return platforms
+}
+
+// validatePlatforms() reports every unknown platform in the list at the given path
+func validatePlatforms(path string, platforms PlatformList) []string {
+	var errs []string
+	for i, p := range platforms {
+		if p == platformsAuto {
+			if len(platforms) > 1 {
+				errs = append(errs, fmt.Sprintf("%s[%d]: %s must be the only entry", path, i, platformsAuto))
+			}
+			continue
+		}
+		if _, ok := platformID(p); !ok {
+			errs = append(errs, fmt.Sprintf("%s[%d]: unknown platform %q, must be an ID or name of %s", path, i, p, platformNames()))
+		}
+	}
+	return errs
+}
+
+// platformNames() lists all known platforms with their IDs, ordered by ID
+func platformNames() string {
+	ids := make([]int, 0, len(Platforms))
+	for id := range Platforms {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, fmt.Sprintf("%s (%d)", Platforms[id], id))
+	}
+	return strings.Join(names, ", ")
+}
+
+// platforms() returns the platforms scraped for the given account mapped to their names,
+// and whether the account's subscriptions have to be discovered among them
+// - the account's own platforms take precedence over the global ones, all platforms are scraped if neither is configured
+func (c *Config) platforms(account AccountConfig) (map[int]string, bool) {
+	selected := account.Platforms
+	if len(selected) == 0 {
+		selected = c.Platforms
+	}
+	if len(selected) == 0 {
+		return Platforms, false
+	}
+	if selected.auto() {
+		return Platforms, true
+	}
+	platforms := make(map[int]string, len(selected))
+	for _, p := range selected.ids() {
+		platforms[p] = Platforms[p]
+	}
+	return platforms, false
+}
+
+// metrics() returns the metric types fetched for every given platform of the given account, leaving out platforms without any
+// - the most specific setting takes precedence: the account's platform_metrics, the account's metrics,
+// the global platform_metrics and finally the global metrics
+func (c *Config) metrics(account AccountConfig, platforms map[int]string) metricSelection {
+	selection := make(metricSelection, len(platforms))
+	for p := range platforms {
+		metrics, ok := platformMetrics(account.PlatformMetrics, p)
+		if !ok && len(account.Metrics) > 0 {
+			metrics, ok = account.Metrics, true
+		}
+		if !ok {
+			metrics, ok = platformMetrics(c.PlatformMetrics, p)
+		}
+		if !ok {
+			metrics = c.Metrics
+		}
+		if len(metrics) > 0 {
+			selection[p] = metrics
+		}
+	}
+	return selection
+}
+
+// platformMetrics() looks up the metric types of a platform in a map keyed by platform IDs or names
+func platformMetrics(metrics map[string][]string, platform int) ([]string, bool) {
+	for p, m := range metrics {
+		if id, ok := platformID(p); ok && id == platform {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// validateMetrics() reports every unknown metric type in the list at the given path
+func validateMetrics(path string, metrics []string) []string {
+	var errs []string
+	for i, m := range metrics {
+		if !contains(metricTypes, m) {
+			errs = append(errs, fmt.Sprintf("%s[%d]: unknown metric type %q, must be one of %s", path, i, m, strings.Join(metricTypes, ", ")))
+		}
+	}
+	return errs
+}
+
+// validatePlatformMetrics() reports every unknown platform and metric type in the map at the given path
+// - an empty list is valid and fetches nothing for that platform
+func validatePlatformMetrics(path string, metrics map[string][]string) []string {
+	var errs []string
+	ids := make(map[int]string, len(metrics))
+	for _, p := range sortedKeys(metrics) {
+		id, ok := platformID(p)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s.%s: unknown platform, must be an ID or name of %s", path, p, platformNames()))
+			continue
+		}
+		if other, ok := ids[id]; ok {
+			errs = append(errs, fmt.Sprintf("%s.%s: platform is already set as %s", path, p, other))
+		}
+		ids[id] = p
+		errs = append(errs, validateMetrics(joinPath(path, p), metrics[p])...)
+	}
+	return errs
+}
+
+// contains() reports whether the given list contains the given string
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errs    []string
+	}{
+		{"valid", "poll_interval: 30s\nclient:\n  retries: 5\n", nil},
+		{"unknown key", "pol_interval: 30s\n", []string{"pol_interval: unknown key"}},
+		{"unknown nested key", "client:\n  timout: 5s\n", []string{"client.timout: unknown key"}},
+		{"unknown key in list", "accounts:\n  - id: ABCD\n    tokn: secret\n", []string{"accounts[0].tokn: unknown key"}},
+		{"type error", "client:\n  retries: many\n", []string{"line 2: cannot unmarshal !!str `many` into int"}},
+		{"several errors", "client:\n  retries: many\n  timout: 5s\npoll_interval: soon\nreporting:\n  delai: 1h\n", []string{
+			"client.timout: unknown key",
+			"reporting.delai: unknown key",
+			"line 2: cannot unmarshal !!str `many` into int",
+			"line 4: cannot unmarshal !!str `soon` into time.Duration",
+		}},
+		{"syntax error", "client: [\n", []string{"yaml: line 1: did not find expected node content"}},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		if got := cfg.parse([]byte(tt.content)); !reflect.DeepEqual(got, tt.errs) {
+			t.Errorf("%s: parse() = %q, want %q", tt.name, got, tt.errs)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		check func(cfg Config) bool
+		errs  []string
+	}{
+		{"token file", map[string]string{"EDGECAST_ACCOUNT_ID": "ABCD", "EDGECAST_TOKEN_FILE": "/run/secrets/token"}, func(cfg Config) bool {
+			return reflect.DeepEqual(cfg.Accounts[0], AccountConfig{ID: "ABCD", TokenFile: "/run/secrets/token"})
+		}, nil},
+		{"token file replaces token", map[string]string{"EDGECAST_TOKEN_FILE": "/run/secrets/token"}, func(cfg Config) bool {
+			return cfg.Accounts[0].Token == "" && cfg.Accounts[0].TokenFile == "/run/secrets/token"
+		}, nil},
+		{"token and token file", map[string]string{"EDGECAST_TOKEN": "secret", "EDGECAST_TOKEN_FILE": "/run/secrets/token"}, func(cfg Config) bool {
+			return cfg.Accounts[0].Token == "secret" && cfg.Accounts[0].TokenFile == ""
+		}, []string{"EDGECAST_TOKEN_FILE: must not be set together with EDGECAST_TOKEN"}},
+		{"listen addresses", map[string]string{"EDGECAST_LISTEN_ADDRESS": ":9100,[::1]:9100"}, func(cfg Config) bool {
+			return reflect.DeepEqual(cfg.Web.ListenAddresses, []string{":9100", "[::1]:9100"})
+		}, nil},
+		{"poll interval", map[string]string{"EDGECAST_POLL_INTERVAL": "30s"}, func(cfg Config) bool {
+			return cfg.PollInterval == 30*time.Second
+		}, nil},
+		{"invalid poll interval", map[string]string{"EDGECAST_POLL_INTERVAL": "soon"}, func(cfg Config) bool {
+			return cfg.PollInterval == DefaultConfig().PollInterval
+		}, []string{`EDGECAST_POLL_INTERVAL: invalid duration "soon"`}},
+		{"nothing set", nil, func(cfg Config) bool {
+			want := DefaultConfig()
+			want.Accounts = []AccountConfig{{Token: "secret"}}
+			return reflect.DeepEqual(cfg, want)
+		}, nil},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.Accounts = []AccountConfig{{Token: "secret"}}
+		errs := cfg.applyEnv(func(key string) string { return tt.env[key] })
+		if !reflect.DeepEqual(errs, tt.errs) {
+			t.Errorf("%s: applyEnv() = %q, want %q", tt.name, errs, tt.errs)
+		}
+		if !tt.check(cfg) {
+			t.Errorf("%s: unexpected configuration %+v", tt.name, cfg)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	token := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(token, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "edgecast.yml")
+	content := "accounts:\n  - id: ABCD\n    token: secret\nclient:\n  timout: 5s\n  retries: -1\npoll_interval: 1m\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// every problem of the file, the environment and the resulting values is reported at once
+	t.Setenv("EDGECAST_TOKEN_FILE", token)
+	t.Setenv("EDGECAST_POLL_INTERVAL", "0s")
+	_, err := LoadConfig(file)
+	want := "invalid configuration:\n" +
+		"  client.timout: unknown key\n" +
+		"  client.retries: must be at least 1, got -1\n" +
+		"  poll_interval: must be positive, got 0s"
+	if err == nil || err.Error() != want {
+		t.Errorf("LoadConfig() error = %v, want %s", err, want)
+	}
+
+	// the token file of the environment replaces the token of the file
+	if err := ioutil.WriteFile(file, []byte("accounts:\n  - id: ABCD\n    token: secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EDGECAST_POLL_INTERVAL", "30s")
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (AccountConfig{ID: "ABCD", TokenFile: token}); !reflect.DeepEqual(cfg.Accounts[0], want) || cfg.PollInterval != 30*time.Second {
+		t.Errorf("LoadConfig() = %+v with poll interval %s, want account %+v and 30s", cfg.Accounts[0], cfg.PollInterval, want)
+	}
+}
+
+func TestValidateAccounts(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Accounts = []AccountConfig{
+		{ID: "ABCD", Token: "secret", Name: "main"},
+		{ID: "EFGH", Token: "secret"},
+		{ID: "main", Token: "secret"},
+		{ID: "IJKL", Token: "secret", Name: "EFGH"},
+		{Token: "secret", Name: "other"},
+	}
+
+	want := []string{
+		`accounts[2].name: "main" is already used by accounts[0]`,
+		`accounts[3].name: "EFGH" is already used by accounts[1]`,
+		`accounts[4].id: must not be empty`,
+	}
+	if got := cfg.validate(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("validate() = %q, want %q", got, want)
+	}
+}
+
+func TestAccountPlatforms(t *testing.T) {
+	cfg := DefaultConfig()
+	tests := []struct {
+		name     string
+		global   PlatformList
+		account  PlatformList
+		want     map[int]string
+		wantAuto bool
+	}{
+		{"all platforms by default", nil, nil, Platforms, false},
+		{"global platforms", PlatformList{"3", "http_small"}, nil, map[int]string{3: "http_large", 8: "http_small"}, false},
+		{"account platforms take precedence", PlatformList{"3"}, PlatformList{"adn"}, map[int]string{14: "adn"}, false},
+		{"auto", nil, PlatformList{platformsAuto}, Platforms, true},
+	}
+	for _, tt := range tests {
+		cfg.Platforms = tt.global
+		got, auto := cfg.platforms(AccountConfig{ID: "ABCD", Platforms: tt.account})
+		if !reflect.DeepEqual(got, tt.want) || auto != tt.wantAuto {
+			t.Errorf("%s: platforms() = %v, %v, want %v, %v", tt.name, got, auto, tt.want, tt.wantAuto)
+		}
+	}
+}
+
+func TestTarget(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Accounts = []AccountConfig{{ID: "ABCD", Name: "main"}, {ID: "EFGH"}}
+	cfg.Secrets = []AccountConfig{{ID: "IJKL", Name: "other"}}
+
+	tests := []struct {
+		name   string
+		want   string // ID of the account
+		wantOK bool
+	}{
+		{"main", "ABCD", true},
+		{"EFGH", "EFGH", true},
+		{"other", "IJKL", true},
+		{"ABCD", "", false}, // named accounts are only found by their name
+		{"IJKL", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := cfg.target(tt.name)
+		if got.ID != tt.want || ok != tt.wantOK {
+			t.Errorf("target(%q) = %s, %v, want %s, %v", tt.name, got.ID, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestValidateSecretNames(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Accounts = []AccountConfig{{ID: "ABCD", Token: "secret", Name: "main"}, {ID: "EFGH", Token: "secret"}}
+	cfg.Secrets = []AccountConfig{{ID: "IJKL", Token: "secret", Name: "main"}, {ID: "MNOP", Token: "secret", Name: "EFGH"}, {ID: "QRST", Token: "secret", Name: "probe"}}
+
+	want := []string{
+		`secrets[0].name: "main" is already used by accounts[0]`,
+		`secrets[1].name: "EFGH" is already used by accounts[1]`,
+	}
+	if got := cfg.validate(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("validate() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateCacheStatusClasses(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Accounts = []AccountConfig{{ID: "ABCD", Token: "secret"}}
+	cfg.CacheStatusClasses = map[string][]string{
+		"hit":  {"TCP_HIT", "TCP_EXPIRED_HIT"},
+		"miss": {"TCP_MISS", "TCP_EXPIRED_HIT"},
+	}
+
+	want := []string{`cache_status_classes.miss[1]: "TCP_EXPIRED_HIT" is already classified as hit`}
+	if got := cfg.validate(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("validate() = %q, want %q", got, want)
+	}
+}
+
+func TestPlatformID(t *testing.T) {
+	tests := []struct {
+		platform string
+		id       int
+		ok       bool
+	}{
+		{"3", 3, true},
+		{"http_large", 3, true},
+		{"adn", 14, true},
+		{"15", 15, true},
+		{"4", 0, false},
+		{"HTTP_LARGE", 0, false},
+		{" 3", 0, false},
+		{"auto", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		id, ok := platformID(tt.platform)
+		if ok != tt.ok || (ok && id != tt.id) {
+			t.Errorf("platformID(%q) = %d, %v, want %d, %v", tt.platform, id, ok, tt.id, tt.ok)
+		}
+	}
+}
+
+func TestParsePlatforms(t *testing.T) {
+	tests := map[string]PlatformList{
+		"3":                       {"3"},
+		"http_large,adn":          {"http_large", "adn"},
+		" http_large , 14 ,flash": {"http_large", "14", "flash"},
+		"auto":                    {"auto"},
+	}
+	for list, want := range tests {
+		if got := parsePlatforms(list); !reflect.DeepEqual(got, want) {
+			t.Errorf("parsePlatforms(%q) = %q, want %q", list, got, want)
+		}
+	}
+	if got := parsePlatforms("http_large, 14").ids(); !reflect.DeepEqual(got, []int{3, 14}) {
+		t.Errorf("ids() = %v, want [3 14]", got)
+	}
+}
+
+func TestValidatePlatforms(t *testing.T) {
+	tests := []struct {
+		platforms PlatformList
+		errs      int
+	}{
+		{PlatformList{"3", "adn", "ssl_http_small"}, 0},
+		{PlatformList{"auto"}, 0},
+		{nil, 0},
+		{PlatformList{"auto", "3"}, 1},
+		{PlatformList{"3", "auto"}, 1},
+		{PlatformList{"4", "http_huge", "3"}, 2},
+		{PlatformList{""}, 1},
+		{PlatformList{" 3"}, 1}, // whitespace is trimmed by parsePlatforms only
+	}
+	for _, tt := range tests {
+		if errs := validatePlatforms("platforms", tt.platforms); len(errs) != tt.errs {
+			t.Errorf("validatePlatforms(%q) = %q, want %d errors", tt.platforms, errs, tt.errs)
+		}
+	}
+}
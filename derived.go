@@ -0,0 +1,106 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/trivago/exporter-edgecast/edgecast"
+)
+
+// classes of cache statuses, every cache status not listed in the classification table is of class "other"
+const (
+	cacheClassHit         = "hit"
+	cacheClassMiss        = "miss"
+	cacheClassUncacheable = "uncacheable"
+	cacheClassOther       = "other"
+)
+
+var (
+	// cacheClassNames lists all classes of cache statuses in the order they are exposed
+	cacheClassNames = []string{cacheClassHit, cacheClassMiss, cacheClassUncacheable, cacheClassOther}
+	// configurableCacheClasses lists the classes of cache statuses the classification table may assign
+	configurableCacheClasses = []string{cacheClassHit, cacheClassMiss, cacheClassUncacheable}
+
+	// statusClasses lists the classes of status codes the status codes are re-aggregated into
+	statusClasses = []string{"1xx", "2xx", "3xx", "4xx", "5xx"}
+	// errorClasses lists the classes of status codes an error ratio is exposed for
+	errorClasses = []string{"4xx", "5xx"}
+
+	// Prepared Description of all metrics derived from the fetched metrics
+	cacheClassConnections = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "cache_class", "connections"), "Current connections per platform and class of cache statuses (hit, miss, uncacheable, other).", []string{"account", "platform", "class"}, nil,
+	)
+	cacheHitRatio = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "cache", "hit_ratio"), "Ratio of cache hits to cache hits and misses per platform.", []string{"account", "platform"}, nil,
+	)
+	statusClassConnections = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "status_class", "connections"), "Current connections per platform and class of HTTP status codes, summing up exact codes and classes.", []string{"account", "platform", "class"}, nil,
+	)
+	errorRatio = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "", "error_ratio"), "Ratio of connections with 4xx or 5xx status codes to all connections per platform.", []string{"account", "platform", "class"}, nil,
+	)
+)
+
+// defaultCacheStatusClasses returns the default classification table of cache statuses
+func defaultCacheStatusClasses() map[string][]string {
+	return map[string][]string{
+		cacheClassHit:         {"TCP_HIT", "TCP_EXPIRED_HIT", "TCP_PARTIAL_HIT"},
+		cacheClassMiss:        {"TCP_MISS", "TCP_EXPIRED_MISS", "TCP_CLIENT_REFRESH_MISS"},
+		cacheClassUncacheable: {"CONFIG_NOCACHE", "UNCACHEABLE"},
+	}
+}
+
+// cacheClass() returns the class of the given cache status, "other" if it is not part of the classification table
+func (opts collectorOptions) cacheClass(status string) string {
+	if class, ok := opts.cacheClasses[status]; ok {
+		return class
+	}
+	return cacheClassOther
+}
+
+// cacheClasses() pushes the connections per class of cache statuses and the cache hit ratio to the channel
+// - the hit ratio is left out while there are neither hits nor misses
+func (col EdgecastCollector) cacheClasses(ch chan<- prometheus.Metric, platform int, cs *edgecast.CacheStatusData) {
+	totals := make(map[string]float64, len(cacheClassNames))
+	for _, entry := range *cs {
+		totals[col.opts.cacheClass(entry.CacheStatus)] += float64(entry.Connections)
+	}
+	for _, class := range cacheClassNames {
+		ch <- prometheus.MustNewConstMetric(cacheClassConnections, prometheus.GaugeValue, totals[class], col.account, Platforms[platform], class)
+	}
+	if cacheable := totals[cacheClassHit] + totals[cacheClassMiss]; cacheable > 0 {
+		ch <- prometheus.MustNewConstMetric(cacheHitRatio, prometheus.GaugeValue, totals[cacheClassHit]/cacheable, col.account, Platforms[platform])
+	}
+}
+
+// statusClassTotals() sums up the connections of the given status codes per class
+// - the API returns the most frequent status codes on their own and all others of the same class as a whole (e.g. "403", "404" and "4xx"),
+// so the entries of a class don't overlap and add up to the connections of that class
+func statusClassTotals(sc *edgecast.StatusCodeData) (totals map[string]float64, total float64) {
+	totals = make(map[string]float64, len(statusClasses)+1)
+	for _, entry := range *sc {
+		total += float64(entry.Connections)
+		totals[statusClass(entry.StatusCode)] += float64(entry.Connections)
+	}
+	return totals, total
+}
+
+// statusClasses() pushes the connections re-aggregated into the classes 1xx to 5xx to the channel
+// - connections without a valid status code (e.g. "other") are left out
+func (col EdgecastCollector) statusClasses(ch chan<- prometheus.Metric, platform int, sc *edgecast.StatusCodeData) {
+	totals, _ := statusClassTotals(sc)
+	for _, class := range statusClasses {
+		ch <- prometheus.MustNewConstMetric(statusClassConnections, prometheus.GaugeValue, totals[class], col.account, Platforms[platform], class)
+	}
+}
+
+// errorRatios() pushes the ratio of connections with 4xx and 5xx status codes to all connections to the channel
+// - exact codes and classes returned by the API count towards the same class, e.g. "404" and "4xx" towards "4xx"
+// - the ratios are left out while there are no connections at all
+func (col EdgecastCollector) errorRatios(ch chan<- prometheus.Metric, platform int, sc *edgecast.StatusCodeData) {
+	totals, total := statusClassTotals(sc)
+	if total <= 0 {
+		return
+	}
+	for _, class := range errorClasses {
+		ch <- prometheus.MustNewConstMetric(errorRatio, prometheus.GaugeValue, totals[class]/total, col.account, Platforms[platform], class)
+	}
+}
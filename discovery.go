@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trivago/exporter-edgecast/edgecast"
+)
+
+// discoverPlatforms() queries the bandwidth of each of the given platforms once
+// and returns those the account is subscribed to
+// - platforms failing for any other reason than a missing subscription are kept, so a flaky API doesn't drop them
+func discoverPlatforms(ctx context.Context, ec EdgecastInterface, platforms map[int]string) map[int]string {
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	subscribed := make(map[int]string, len(platforms))
+	for id, name := range platforms {
+		wg.Add(1)
+		go func(id int, name string) {
+			defer wg.Done()
+			if _, err := ec.Bandwidth(ctx, id); notSubscribed(err) {
+				return
+			}
+			mtx.Lock()
+			subscribed[id] = name
+			mtx.Unlock()
+		}(id, name)
+	}
+	wg.Wait()
+	return subscribed
+}
+
+// platformCache remembers which platforms an account is subscribed to, so probes selecting auto don't query every platform again
+type platformCache struct {
+	ttl time.Duration
+
+	mtx     sync.Mutex
+	entries map[int]platformEntry
+}
+
+// platformEntry is the outcome of the latest discovery of a platform
+type platformEntry struct {
+	subscribed bool
+	checked    time.Time
+}
+
+func newPlatformCache(ttl time.Duration) *platformCache {
+	return &platformCache{ttl: ttl, entries: make(map[int]platformEntry)}
+}
+
+// discover() returns those of the given platforms the account is subscribed to, like discoverPlatforms()
+// - only platforms that weren't discovered within the TTL are queried
+// - the outcome of a discovery that was cancelled or timed out isn't remembered, as it keeps the platforms that didn't answer
+func (c *platformCache) discover(ctx context.Context, ec EdgecastInterface, platforms map[int]string) map[int]string {
+	subscribed := make(map[int]string, len(platforms))
+	unknown := make(map[int]string)
+	c.mtx.Lock()
+	for id, name := range platforms {
+		entry, ok := c.entries[id]
+		switch {
+		case !ok || time.Since(entry.checked) >= c.ttl:
+			unknown[id] = name
+		case entry.subscribed:
+			subscribed[id] = name
+		}
+	}
+	c.mtx.Unlock()
+	if len(unknown) == 0 {
+		return subscribed
+	}
+
+	discovered := discoverPlatforms(ctx, ec, unknown)
+	for id, name := range discovered {
+		subscribed[id] = name
+	}
+	if ctx.Err() == nil {
+		now := time.Now()
+		c.mtx.Lock()
+		for id := range unknown {
+			_, ok := discovered[id]
+			c.entries[id] = platformEntry{subscribed: ok, checked: now}
+		}
+		c.mtx.Unlock()
+	}
+	return subscribed
+}
+
+// notSubscribed() reports whether the API rejected a request because the account isn't subscribed to the requested platform
+// - the API answers such requests with 403 or another client error, while 401 means the token is invalid for all platforms
+func notSubscribed(err error) bool {
+	switch e := err.(type) {
+	case *edgecast.AuthError:
+		return e.StatusCode == http.StatusForbidden
+	case *edgecast.StatusError:
+		return e.StatusCode >= 400 && e.StatusCode < 500
+	default:
+		return false
+	}
+}
+
+// platformList() returns the names of the given platforms in alphabetical order, e.g. for logging
+func platformList(platforms map[int]string) string {
+	names := make([]string, 0, len(platforms))
+	for _, name := range platforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/trivago/exporter-edgecast/edgecast"
+)
+
+func TestNotSubscribed(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{&edgecast.AuthError{StatusCode: http.StatusForbidden}, true},
+		{&edgecast.AuthError{StatusCode: http.StatusUnauthorized}, false},
+		{&edgecast.StatusError{StatusCode: http.StatusBadRequest}, true},
+		{&edgecast.StatusError{StatusCode: http.StatusNotFound}, true},
+		{&edgecast.ServerError{StatusCode: http.StatusInternalServerError}, false},
+		{&edgecast.RateLimitError{}, false},
+		{context.DeadlineExceeded, false},
+		{errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := notSubscribed(tt.err); got != tt.want {
+			t.Errorf("notSubscribed(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// discoveryService answers Bandwidth with the error of the platform, blocking until ctx is done for platforms without entry
+type discoveryService struct {
+	fixtureService
+	errs map[int]error
+}
+
+func (s discoveryService) Bandwidth(ctx context.Context, platform int) (*edgecast.BandwidthData, error) {
+	err, ok := s.errs[platform]
+	if !ok {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.fixtureService.Bandwidth(ctx, platform)
+}
+
+func TestDiscoverPlatforms(t *testing.T) {
+	svc := discoveryService{fixtureService{t}, map[int]error{
+		2:  &edgecast.AuthError{StatusCode: http.StatusForbidden},
+		3:  nil,
+		8:  &edgecast.StatusError{StatusCode: http.StatusBadRequest},
+		14: &edgecast.ServerError{StatusCode: http.StatusBadGateway},
+	}}
+
+	// platform 15 doesn't answer before the timeout and is kept like the failing adn
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	got := discoverPlatforms(ctx, svc, map[int]string{2: "flash", 3: "http_large", 8: "http_small", 14: "adn", 15: "ssl_adn"})
+	want := map[int]string{3: "http_large", 14: "adn", 15: "ssl_adn"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("discoverPlatforms() = %v, want %v", got, want)
+	}
+}
+
+func TestPlatformCache(t *testing.T) {
+	svc := &breakerService{fixtureService: fixtureService{t}}
+	cache := newPlatformCache(50 * time.Millisecond)
+	platforms := map[int]string{3: "http_large", 8: "http_small"}
+	discover := func(ctx context.Context, want map[int]string, calls int) {
+		t.Helper()
+		svc.calls = 0
+		if got := cache.discover(ctx, svc, platforms); !reflect.DeepEqual(got, want) {
+			t.Errorf("discover() = %v, want %v", got, want)
+		}
+		if svc.calls != calls {
+			t.Errorf("discover() called the API %d times, want %d", svc.calls, calls)
+		}
+	}
+
+	// a cancelled discovery keeps all platforms, but isn't remembered
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	svc.err = context.Canceled
+	discover(ctx, platforms, 2)
+
+	svc.err = &edgecast.AuthError{StatusCode: http.StatusForbidden}
+	discover(context.Background(), map[int]string{}, 2)
+	svc.err = nil
+	discover(context.Background(), map[int]string{}, 0)
+
+	// the platforms are queried again once the TTL passed
+	time.Sleep(60 * time.Millisecond)
+	discover(context.Background(), platforms, 2)
+	discover(context.Background(), platforms, 0)
+}
@@ -0,0 +1,261 @@
+// Package edgecast implements a client for the real-time statistics and reports of the Edgecast CDN API
+package edgecast
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBaseURL holds the URL of the Edgecast real-time statistics API
+	DefaultBaseURL = "https://api.edgecast.com/v2/realtimestats"
+
+	// DefaultRequestRetries defines the default number of http requests before giving up
+	DefaultRequestRetries = 3
+
+	// DefaultRequestTimeout defines the default timeout of a single http request
+	DefaultRequestTimeout = 5 * time.Second
+
+	// MethodBandwidth is the endpoint for Edgecast bandwidth
+	MethodBandwidth = "bandwidth"
+	// MethodConnections is the endpoint for Edgecast connections
+	MethodConnections = "connections"
+	// MethodCachestatus is the endpoint for the Edgecast cache status
+	MethodCachestatus = "cachestatus"
+	// MethodStatuscodes is the endpoint for the Edgecast status codes
+	MethodStatuscodes = "statuscode"
+)
+
+// Media types (also known as "platform")
+// They are identified by an integer value and passed to the API url.
+//
+// Unfortunately the stats aren't more fine grained than this. If you have
+// more than one 'service' using the platform(s), you'll get them added together.
+const (
+	MediaTypeFlash    = 2
+	MediaTypeLarge    = 3
+	MediaTypeLargeSSL = 7
+	MediaTypeSmall    = 8
+	MediaTypeSmallSSL = 9
+	MediaTypeADN      = 14
+	MediaTypeADNSSL   = 15
+)
+
+// defaultHTTPClient is shared by all clients, so they reuse the connections of a single transport
+var defaultHTTPClient = &http.Client{}
+
+// TokenSource provides the token of an account before every single request, e.g. to rotate it without recreating the client
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// Client queries the Edgecast API for a single customer account
+type Client struct {
+	AccountID    string
+	Token        string
+	BaseURL      string
+	ReportingURL string
+	MCCURL       string
+	Retry        RetryPolicy
+	Timeout      time.Duration
+
+	httpClient *http.Client
+	limiters   []*Limiter  // acquired in order before every single request
+	tokens     TokenSource // takes precedence over Token if set
+}
+
+// NewClient creates a new Edgecast client for the given account using the default settings
+func NewClient(accountID, token string) *Client {
+	return &Client{
+		AccountID:    accountID,
+		Token:        token,
+		BaseURL:      DefaultBaseURL,
+		ReportingURL: DefaultReportingURL,
+		MCCURL:       DefaultMCCURL,
+		Retry:        DefaultRetryPolicy(),
+		Timeout:      DefaultRequestTimeout,
+		httpClient:   defaultHTTPClient,
+	}
+}
+
+// SetBaseURL sets the URL of the API, e.g. to query a proxy or a test server
+func (c *Client) SetBaseURL(baseURL string) *Client {
+	c.BaseURL = strings.TrimSuffix(baseURL, "/")
+	return c
+}
+
+// SetReportingURL sets the URL of the reporting API, e.g. to query a proxy or a test server
+func (c *Client) SetReportingURL(reportingURL string) *Client {
+	c.ReportingURL = strings.TrimSuffix(reportingURL, "/")
+	return c
+}
+
+// SetMCCURL sets the URL of the media control center API, e.g. to query a proxy or a test server
+func (c *Client) SetMCCURL(mccURL string) *Client {
+	c.MCCURL = strings.TrimSuffix(mccURL, "/")
+	return c
+}
+
+// SetRetries sets the number of attempts per request until giving up
+func (c *Client) SetRetries(retries int) *Client {
+	c.Retry.MaxAttempts = retries
+	return c
+}
+
+// SetRetryPolicy sets how temporarily failing requests are retried
+func (c *Client) SetRetryPolicy(policy RetryPolicy) *Client {
+	c.Retry = policy
+	return c
+}
+
+// SetTimeout sets the timeout of a single attempt
+func (c *Client) SetTimeout(timeout time.Duration) *Client {
+	c.Timeout = timeout
+	return c
+}
+
+// SetHTTPClient sets the http.Client used to send the requests
+func (c *Client) SetHTTPClient(httpClient *http.Client) *Client {
+	c.httpClient = httpClient
+	return c
+}
+
+// SetLimiters sets the limiters every single request (including retries) has to pass
+// - limiters of a single client should be given before shared ones, so a client waiting for its own limits doesn't block the others
+// - limiters shared by several clients must be given in the same order to all of them
+func (c *Client) SetLimiters(limiters ...*Limiter) *Client {
+	c.limiters = limiters
+	return c
+}
+
+// SetTokenSource sets the source of the token sent with every single request instead of the static Token
+func (c *Client) SetTokenSource(tokens TokenSource) *Client {
+	c.tokens = tokens
+	return c
+}
+
+// Bandwidth returns the current bandwidth usage
+func (c *Client) Bandwidth(ctx context.Context, platform int) (*BandwidthData, error) {
+	var data RawEdgecastResult
+	if err := c.get(ctx, platform, MethodBandwidth, &data); err != nil {
+		return nil, err
+	}
+	return &BandwidthData{Bps: data.Result, Platform: platform}, nil
+}
+
+// Connections returns the current number of connections
+func (c *Client) Connections(ctx context.Context, platform int) (*ConnectionData, error) {
+	var data RawEdgecastResult
+	if err := c.get(ctx, platform, MethodConnections, &data); err != nil {
+		return nil, err
+	}
+	return &ConnectionData{Connections: data.Result, Platform: platform}, nil
+}
+
+// CacheStatus returns the current cache status breakdown
+func (c *Client) CacheStatus(ctx context.Context, platform int) (*CacheStatusData, error) {
+	var data CacheStatusData
+	if err := c.get(ctx, platform, MethodCachestatus, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// StatusCodes returns the current HTTP status code breakdown
+func (c *Client) StatusCodes(ctx context.Context, platform int) (*StatusCodeData, error) {
+	var data StatusCodeData
+	if err := c.get(ctx, platform, MethodStatuscodes, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// fullURL creates a queryable URL for the given platform and method
+func (c *Client) fullURL(platform int, method string) string {
+	return fmt.Sprintf("%s/customers/%s/media/%d/%s", c.BaseURL, c.AccountID, platform, method)
+}
+
+// get requests the given method endpoint and decodes the JSON response body into data
+func (c *Client) get(ctx context.Context, platform int, method string, data interface{}) error {
+	return c.getURL(ctx, c.fullURL(platform, method), data)
+}
+
+// getURL requests the given URL and decodes the JSON response body into data
+func (c *Client) getURL(ctx context.Context, url string, data interface{}) error {
+	return c.call(ctx, http.MethodGet, url, nil, data)
+}
+
+// call sends a request with the given method and JSON payload to the given URL and decodes the JSON response body into data
+// - temporary errors are retried according to the retry policy, unless the context is done
+// - requests other than GET aren't idempotent, they are only retried if the API refused to process them
+func (c *Client) call(ctx context.Context, method, url string, payload []byte, data interface{}) error {
+	begin := time.Now()
+	retryable := temporary
+	if method != http.MethodGet {
+		retryable = unprocessed
+	}
+
+	for attempt := 1; ; attempt++ {
+		body, err := c.request(ctx, method, url, payload)
+		if err == nil {
+			if err = json.Unmarshal(body, data); err != nil {
+				return &DecodeError{Body: body, Err: err}
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !retryable(err) || attempt >= c.Retry.MaxAttempts || !c.Retry.wait(ctx, begin, attempt, err) {
+			return err
+		}
+	}
+}
+
+// request runs a single API request once the limiters allow it and returns the raw response body or an error
+func (c *Client) request(ctx context.Context, method, url string, payload []byte) ([]byte, error) {
+	token := c.Token
+	if c.tokens != nil {
+		var err error
+		if token, err = c.tokens.Token(); err != nil {
+			return nil, &TokenError{Err: err}
+		}
+	}
+
+	release, err := acquireAll(ctx, c.limiters)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Add("Authorization", "TOK:"+token)
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		_, _ = io.Copy(ioutil.Discard, resp.Body) // drain the body, so the connection can be reused
+		return nil, err
+	}
+	return ioutil.ReadAll(resp.Body)
+}
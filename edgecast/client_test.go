@@ -0,0 +1,221 @@
+package edgecast
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fixture reads a response body from the fixtures shared with the exporter
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := ioutil.ReadFile(filepath.Join("..", "testing", "fixtures", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// newTestClient creates a client querying a test server that answers every request with the given handler
+// - requests are not retried unless the test sets a retry policy
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewClient("ABCD", "secret").SetBaseURL(server.URL + "/").SetRetries(1)
+}
+
+// fastRetryPolicy retries up to the given number of attempts without noticeable delays
+func fastRetryPolicy(attempts int) RetryPolicy {
+	return RetryPolicy{MaxAttempts: attempts, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Multiplier: 2}
+}
+
+// respond answers every request with the given status code and body
+func respond(code int, body []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+		_, _ = w.Write(body)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	var gotPath, gotAuth string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.Path, r.Header.Get("Authorization")
+		_, _ = w.Write(fixture(t, "bandwidth.json"))
+	})
+
+	if _, err := c.Bandwidth(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/customers/ABCD/media/3/bandwidth"; gotPath != want {
+		t.Errorf("path = %q, want %q", gotPath, want)
+	}
+	if want := "TOK:secret"; gotAuth != want {
+		t.Errorf("Authorization = %q, want %q", gotAuth, want)
+	}
+}
+
+func TestBandwidth(t *testing.T) {
+	c := newTestClient(t, respond(http.StatusOK, fixture(t, "bandwidth.json")))
+
+	got, err := c.Bandwidth(context.Background(), MediaTypeLarge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&BandwidthData{Bps: 42.42, Platform: MediaTypeLarge}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Bandwidth() = %+v, want %+v", got, want)
+	}
+}
+
+func TestConnections(t *testing.T) {
+	c := newTestClient(t, respond(http.StatusOK, fixture(t, "connections.json")))
+
+	got, err := c.Connections(context.Background(), MediaTypeSmall)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&ConnectionData{Connections: 1234.1234, Platform: MediaTypeSmall}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Connections() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCacheStatus(t *testing.T) {
+	c := newTestClient(t, respond(http.StatusOK, fixture(t, "cachestatus.json")))
+
+	got, err := c.CacheStatus(context.Background(), MediaTypeLarge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*got) != 8 {
+		t.Fatalf("CacheStatus() returned %d entries, want 8", len(*got))
+	}
+	if want := (CacheStatusEntry{CacheStatus: "TCP_HIT", Connections: 1}); (*got)[0] != want {
+		t.Errorf("CacheStatus()[0] = %+v, want %+v", (*got)[0], want)
+	}
+	if want := (CacheStatusEntry{CacheStatus: "UNCACHEABLE", Connections: 8}); (*got)[7] != want {
+		t.Errorf("CacheStatus()[7] = %+v, want %+v", (*got)[7], want)
+	}
+}
+
+func TestStatusCodes(t *testing.T) {
+	c := newTestClient(t, respond(http.StatusOK, fixture(t, "statuscodes.json")))
+
+	got, err := c.StatusCodes(context.Background(), MediaTypeLarge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*got) != 8 {
+		t.Fatalf("StatusCodes() returned %d entries, want 8", len(*got))
+	}
+	if want := (StatusCodeEntry{StatusCode: "2xx", Connections: 222}); (*got)[0] != want {
+		t.Errorf("StatusCodes()[0] = %+v, want %+v", (*got)[0], want)
+	}
+	if want := (StatusCodeEntry{StatusCode: "404", Connections: 404}); (*got)[4] != want {
+		t.Errorf("StatusCodes()[4] = %+v, want %+v", (*got)[4], want)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		check   func(error) bool
+	}{
+		{"unauthorized", respond(http.StatusUnauthorized, []byte("<html>Unauthorized</html>")), func(err error) bool {
+			e, ok := err.(*AuthError)
+			return ok && e.StatusCode == http.StatusUnauthorized
+		}},
+		{"forbidden", respond(http.StatusForbidden, nil), func(err error) bool {
+			_, ok := err.(*AuthError)
+			return ok
+		}},
+		{"rate limited", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}, func(err error) bool {
+			e, ok := err.(*RateLimitError)
+			return ok && e.RetryAfter == 7*time.Second
+		}},
+		{"server error", respond(http.StatusBadGateway, nil), func(err error) bool {
+			e, ok := err.(*ServerError)
+			return ok && e.StatusCode == http.StatusBadGateway
+		}},
+		{"not found", respond(http.StatusNotFound, nil), func(err error) bool {
+			e, ok := err.(*StatusError)
+			return ok && e.StatusCode == http.StatusNotFound
+		}},
+		{"invalid json", respond(http.StatusOK, []byte("<html>")), func(err error) bool {
+			e, ok := err.(*DecodeError)
+			return ok && string(e.Body) == "<html>"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, tt.handler)
+			_, err := c.StatusCodes(context.Background(), MediaTypeLarge)
+			if !tt.check(err) {
+				t.Errorf("StatusCodes() error = %#v", err)
+			}
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}).SetRetryPolicy(fastRetryPolicy(3))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Bandwidth(ctx, MediaTypeLarge); err != context.DeadlineExceeded {
+		t.Errorf("Bandwidth() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// tokenFunc implements TokenSource by a function
+type tokenFunc func() (string, error)
+
+func (f tokenFunc) Token() (string, error) {
+	return f()
+}
+
+func TestTokenSource(t *testing.T) {
+	var gotAuth []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+		_, _ = w.Write(fixture(t, "bandwidth.json"))
+	})
+	tokens := []string{"first", "second"}
+	c.SetTokenSource(tokenFunc(func() (string, error) {
+		token := tokens[0]
+		tokens = tokens[1:]
+		return token, nil
+	}))
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Bandwidth(context.Background(), MediaTypeLarge); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"TOK:first", "TOK:second"}; !reflect.DeepEqual(gotAuth, want) {
+		t.Errorf("Authorization = %q, want %q", gotAuth, want)
+	}
+
+	c.SetTokenSource(tokenFunc(func() (string, error) { return "", errors.New("missing") }))
+	if _, err := c.Bandwidth(context.Background(), MediaTypeLarge); err == nil {
+		t.Error("Bandwidth() error = nil, want TokenError")
+	} else if _, ok := err.(*TokenError); !ok {
+		t.Errorf("Bandwidth() error = %#v, want TokenError", err)
+	}
+	if len(gotAuth) != 2 {
+		t.Errorf("%d requests sent, want 2", len(gotAuth))
+	}
+}
@@ -0,0 +1,123 @@
+package edgecast
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AuthError is returned if the API rejects the account ID or token (401, 403)
+type AuthError struct {
+	StatusCode int
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("edgecast: authentication failed (%d %s)", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// RateLimitError is returned if the API throttles the requests of the account (429)
+type RateLimitError struct {
+	RetryAfter time.Duration // delay requested by the Retry-After header, 0 if absent
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("edgecast: rate limited, retry after %s", e.RetryAfter)
+	}
+	return "edgecast: rate limited"
+}
+
+// ServerError is returned if the API fails to handle the request (5xx)
+type ServerError struct {
+	StatusCode int
+	RetryAfter time.Duration // delay requested by the Retry-After header, 0 if absent
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("edgecast: server error (%d %s)", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// StatusError is returned for any other unexpected HTTP status code
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("edgecast: unexpected status (%d %s)", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// DecodeError is returned if the response body is no valid JSON of the expected type
+type DecodeError struct {
+	Body []byte
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("edgecast: cannot decode response: %v", e.Err)
+}
+
+// TokenError is returned if the TokenSource of the client fails to provide a token
+type TokenError struct {
+	Err error
+}
+
+func (e *TokenError) Error() string {
+	return fmt.Sprintf("edgecast: cannot get token: %v", e.Err)
+}
+
+// checkStatus returns the typed error matching the status code of the given response, or nil on success
+func checkStatus(resp *http.Response) error {
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return nil
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return &AuthError{StatusCode: code}
+	case code == http.StatusTooManyRequests:
+		return &RateLimitError{RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+	case code >= 500:
+		return &ServerError{StatusCode: code, RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+	default:
+		return &StatusError{StatusCode: code}
+	}
+}
+
+// retryAfter parses the value of a Retry-After header given in seconds or as HTTP date
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// unprocessed reports whether the API refused a request without processing it,
+// so even a request that isn't idempotent may be retried
+// - network errors and timeouts are not, the request may have reached the API before
+func unprocessed(err error) bool {
+	switch e := err.(type) {
+	case *RateLimitError:
+		return true
+	case *ServerError:
+		return e.StatusCode == http.StatusServiceUnavailable
+	default:
+		return false
+	}
+}
+
+// temporary reports whether a request failing with the given error may succeed when retried
+func temporary(err error) bool {
+	switch err.(type) {
+	case *AuthError, *StatusError, *DecodeError, *TokenError:
+		return false
+	default: // rate limits, server and network errors
+		return true
+	}
+}
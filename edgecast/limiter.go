@@ -0,0 +1,88 @@
+package edgecast
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter throttles the requests of one or more clients using a token bucket and caps the number of requests in flight
+// - a Limiter shared by several clients limits their requests in total
+type Limiter struct {
+	name     string        // reported to wait hooks
+	bucket   *rate.Limiter // nil for no rate limit
+	inFlight chan struct{} // nil for no concurrency cap
+}
+
+// NewLimiter creates a Limiter allowing requestsPerSecond requests (with bursts of up to burst requests)
+// and at most maxInFlight concurrent requests
+// - a requestsPerSecond or maxInFlight of 0 disables the respective limit
+func NewLimiter(name string, requestsPerSecond float64, burst, maxInFlight int) *Limiter {
+	l := &Limiter{name: name}
+	if requestsPerSecond > 0 {
+		l.bucket = rate.NewLimiter(rate.Limit(requestsPerSecond), burst)
+	}
+	if maxInFlight > 0 {
+		l.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+// acquire blocks until a request may be sent or the context is done
+// - the rate token is awaited before the slot, so a throttled request doesn't keep a slot other requests could use
+// - the returned function must be called once the request is finished, to free its slot
+func (l *Limiter) acquire(ctx context.Context) (func(), error) {
+	begin := time.Now()
+
+	if l.bucket != nil {
+		if err := l.bucket.Wait(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+	}
+	release := func() {}
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+			release = func() { <-l.inFlight }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if hook, ok := ctx.Value(waitHookKey{}).(func(string, time.Duration)); ok {
+		hook(l.name, time.Since(begin))
+	}
+	return release, nil
+}
+
+// acquireAll acquires the given limiters in order and returns a function releasing all of them
+func acquireAll(ctx context.Context, limiters []*Limiter) (func(), error) {
+	releases := make([]func(), 0, len(limiters))
+	releaseAll := func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+	for _, l := range limiters {
+		release, err := l.acquire(ctx)
+		if err != nil {
+			releaseAll()
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+	return releaseAll, nil
+}
+
+// waitHookKey is the context key of the hook set by WithWaitHook
+type waitHookKey struct{}
+
+// WithWaitHook returns a copy of ctx that makes the client call hook with the limiter's name and the time spent waiting
+// every time a request passed a limiter
+func WithWaitHook(ctx context.Context, hook func(limiter string, waited time.Duration)) context.Context {
+	return context.WithValue(ctx, waitHookKey{}, hook)
+}
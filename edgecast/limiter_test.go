@@ -0,0 +1,79 @@
+package edgecast
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiterMaxInFlight(t *testing.T) {
+	var inFlight, maxInFlight int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write(fixture(t, "bandwidth.json"))
+	}).SetLimiters(NewLimiter("test", 0, 0, 2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Bandwidth(context.Background(), MediaTypeLarge); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 2 {
+		t.Errorf("max requests in flight = %d, want at most 2", maxInFlight)
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	c := newTestClient(t, respond(http.StatusOK, fixture(t, "bandwidth.json"))).
+		SetLimiters(NewLimiter("test", 20, 1, 0))
+
+	var waited time.Duration
+	ctx := WithWaitHook(context.Background(), func(limiter string, d time.Duration) { waited += d })
+	begin := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := c.Bandwidth(ctx, MediaTypeLarge); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first request passes immediately, the others wait for a token every 50ms
+	if elapsed := time.Since(begin); elapsed < 150*time.Millisecond {
+		t.Errorf("5 requests took %s, want at least 150ms", elapsed)
+	}
+	if waited < 150*time.Millisecond {
+		t.Errorf("reported wait = %s, want at least 150ms", waited)
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	l := NewLimiter("test", 0, 0, 1)
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("acquire() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,59 @@
+package edgecast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// DefaultMCCURL holds the URL of the Edgecast media control center API, which manages purges
+	DefaultMCCURL = "https://api.edgecast.com/v2/mcc"
+
+	// MethodPurge is the endpoint for the purge requests of an account
+	MethodPurge = "edge/purge"
+
+	// purgePageSize is the number of purge requests fetched per page
+	purgePageSize = 500
+	// purgeMaxPages bounds the pages fetched by a single call, so a huge backlog cannot keep it busy forever
+	purgeMaxPages = 20
+)
+
+// PurgeRequests returns all purge requests of the account that were submitted since the given time
+// - the pages of the result are fetched one after another, up to purgeMaxPages
+func (c *Client) PurgeRequests(ctx context.Context, since time.Time) (*PurgeRequestData, error) {
+	var data PurgeRequestData
+	for page := 1; page <= purgeMaxPages; page++ {
+		query := url.Values{
+			"from_date": {since.UTC().Format(reportTimeFormat)},
+			"page":      {fmt.Sprint(page)},
+			"page_size": {fmt.Sprint(purgePageSize)},
+		}
+		var result purgeRequestPage
+		if err := c.getURL(ctx, fmt.Sprintf("%s/customers/%s/%s?%s", c.MCCURL, c.AccountID, MethodPurge, query.Encode()), &result); err != nil {
+			return nil, err
+		}
+		data = append(data, result.Items...)
+		if len(result.Items) < purgePageSize || len(data) >= result.Total {
+			break
+		}
+	}
+	return &data, nil
+}
+
+// Purge submits a purge of the given media path on the given platform and returns the ID of the created purge request
+// - the path is the full URL of the content to purge, using a CNAME or the CDN URL, and may end with a wildcard
+func (c *Client) Purge(ctx context.Context, platform int, path string) (*PurgeData, error) {
+	payload, err := json.Marshal(purgeSubmission{MediaPath: path, MediaType: platform})
+	if err != nil {
+		return nil, err
+	}
+	var data PurgeData
+	if err := c.call(ctx, http.MethodPut, fmt.Sprintf("%s/customers/%s/%s", c.MCCURL, c.AccountID, MethodPurge), payload, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
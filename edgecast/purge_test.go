@@ -0,0 +1,111 @@
+package edgecast
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPurgeRequests(t *testing.T) {
+	var gotPath, gotQuery string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		_, _ = w.Write(fixture(t, "purgerequests.json"))
+	})
+	c.SetMCCURL(c.BaseURL + "/v2/mcc")
+
+	got, err := c.PurgeRequests(context.Background(), time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/v2/mcc/customers/ABCD/edge/purge"; gotPath != want {
+		t.Errorf("path = %q, want %q", gotPath, want)
+	}
+	if want := "from_date=2019-06-01T00%3A00%3A00&page=1&page_size=500"; gotQuery != want {
+		t.Errorf("query = %q, want %q", gotQuery, want)
+	}
+	if len(*got) != 3 {
+		t.Fatalf("PurgeRequests() returned %d purges, want 3", len(*got))
+	}
+
+	purge := (*got)[0]
+	if purge.Pending() || !(*got)[1].Pending() || !(*got)[2].Pending() {
+		t.Errorf("Pending() of the purges = %v, %v, %v, want false, true, true", purge.Pending(), (*got)[1].Pending(), (*got)[2].Pending())
+	}
+	submitted, err := purge.Submitted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC); !submitted.Equal(want) {
+		t.Errorf("Submitted() = %s, want %s", submitted, want)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	var gotMethod, gotPath string
+	var gotBody purgeSubmission
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath = r.Method, r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write([]byte(`{"Id": "5c4e6b4f1e8a"}`))
+	})
+	c.SetMCCURL(c.BaseURL + "/v2/mcc")
+
+	got, err := c.Purge(context.Background(), 8, "http://cdn.example.com/images/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotMethod != http.MethodPut {
+		t.Errorf("method = %s, want PUT", gotMethod)
+	}
+	if want := "/v2/mcc/customers/ABCD/edge/purge"; gotPath != want {
+		t.Errorf("path = %q, want %q", gotPath, want)
+	}
+	if want := (purgeSubmission{MediaPath: "http://cdn.example.com/images/*", MediaType: 8}); gotBody != want {
+		t.Errorf("body = %+v, want %+v", gotBody, want)
+	}
+	if got.ID != "5c4e6b4f1e8a" {
+		t.Errorf("Purge() returned ID %q, want 5c4e6b4f1e8a", got.ID)
+	}
+}
+
+func TestPurgeRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     int // 0 drops the connection without response
+		attempts int32
+	}{
+		{"rate limits are retried", http.StatusTooManyRequests, 3},
+		{"unavailability is retried", http.StatusServiceUnavailable, 3},
+		{"other server errors are not retried", http.StatusInternalServerError, 1},
+		{"network errors are not retried", 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				if tt.code == 0 {
+					conn, _, _ := w.(http.Hijacker).Hijack()
+					conn.Close()
+					return
+				}
+				w.WriteHeader(tt.code)
+			}).SetRetryPolicy(fastRetryPolicy(3))
+			c.SetMCCURL(c.BaseURL + "/v2/mcc")
+
+			if _, err := c.Purge(context.Background(), MediaTypeSmall, "http://cdn.example.com/*"); err == nil {
+				t.Error("Purge() error = nil, want error")
+			}
+			if attempts := atomic.LoadInt32(&attempts); attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package edgecast
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recordingTimeFormat is the timestamp in the file name of a recording, sorting in chronological order
+const recordingTimeFormat = "20060102T150405.000000000Z"
+
+/*
+ * Recorder is an http.RoundTripper that saves the raw body of every response of the Edgecast API to disk,
+ * so the responses can be served by a Replayer later on, e.g. to reproduce an incident or build regression tests.
+ * Every response is saved as <dir>/<account>/<method>/<platform>/<timestamp>-<status>.json, see recordingPath().
+ * Requests failing without a response, e.g. due to timeouts, aren't recorded.
+ */
+type Recorder struct {
+	dir     string
+	next    http.RoundTripper
+	onError func(error) // called if a response cannot be saved, the response is passed on anyway
+}
+
+// NewRecorder creates a Recorder saving the responses of the given transport to dir
+// - onError is called for every response that cannot be saved, it may be nil
+func NewRecorder(dir string, next http.RoundTripper, onError func(error)) *Recorder {
+	if onError == nil {
+		onError = func(error) {}
+	}
+	return &Recorder{dir: dir, next: next, onError: onError}
+}
+
+// RoundTrip sends the request using the wrapped transport and saves the body of the response
+// - implements function of interface http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	path := filepath.Join(r.dir, recordingPath(req), fmt.Sprintf("%s-%d.json", time.Now().UTC().Format(recordingTimeFormat), resp.StatusCode))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		r.onError(err)
+	} else if err := ioutil.WriteFile(path, body, 0600); err != nil {
+		r.onError(err)
+	}
+	return resp, nil
+}
+
+/*
+ * Replayer is an http.RoundTripper serving the responses saved by a Recorder instead of sending requests.
+ * The recordings of every account, method and platform are served one after another in the order they were recorded,
+ * the last one is repeated once all have been served. Requests without any recording are answered with 404.
+ */
+type Replayer struct {
+	dir string
+
+	mtx        sync.Mutex
+	recordings map[string][]string // file names of the recordings per path, listed on the first request
+	served     map[string]int      // number of recordings served per path
+}
+
+// NewReplayer creates a Replayer serving the recordings in dir
+func NewReplayer(dir string) *Replayer {
+	return &Replayer{dir: dir, recordings: make(map[string][]string), served: make(map[string]int)}
+}
+
+// RoundTrip answers the request with the next recording of its account, method and platform
+// - implements function of interface http.RoundTripper
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	path := recordingPath(req)
+	name, err := r.next(path)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return replayResponse(req, http.StatusNotFound, []byte("no recording of "+path)), nil
+	}
+
+	body, err := ioutil.ReadFile(filepath.Join(r.dir, path, name))
+	if err != nil {
+		return nil, err
+	}
+	status, err := strconv.Atoi(strings.TrimSuffix(name[strings.LastIndex(name, "-")+1:], ".json"))
+	if err != nil {
+		return nil, fmt.Errorf("recording %s lacks the status code: %v", name, err)
+	}
+	return replayResponse(req, status, body), nil
+}
+
+// next returns the file name of the next recording of the given path, empty if there is none
+func (r *Replayer) next(path string) (string, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	names, ok := r.recordings[path]
+	if !ok {
+		files, err := ioutil.ReadDir(filepath.Join(r.dir, path))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		for _, f := range files {
+			if !f.IsDir() && strings.HasSuffix(f.Name(), ".json") {
+				names = append(names, f.Name())
+			}
+		}
+		sort.Strings(names)
+		r.recordings[path] = names
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	i := r.served[path]
+	if i >= len(names) {
+		i = len(names) - 1
+	}
+	r.served[path]++
+	return names[i], nil
+}
+
+// replayResponse creates the response to req with the given status code and body
+func replayResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// recordingPath returns the directory of the recordings of a request relative to the recording directory: <account>/<method>/<platform>
+// - method is the endpoint below the account, e.g. bandwidth or bytestransferred_interval, prefixed by the HTTP method unless it is GET
+// - platform is taken from the path or the mediatypeid parameter, 0 for methods that aren't bound to a platform
+func recordingPath(req *http.Request) string {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	account, method, platform := "unknown", segments, "0"
+	for i, s := range segments {
+		if s == "customers" && i+1 < len(segments) {
+			account, method = segments[i+1], segments[i+2:]
+			break
+		}
+	}
+	if len(method) > 2 && method[0] == "media" {
+		platform, method = method[1], method[2:]
+	} else if id := req.URL.Query().Get("mediatypeid"); id != "" {
+		platform = id
+	}
+
+	name := strings.Join(method, "_")
+	if req.Method != "" && req.Method != http.MethodGet {
+		name = strings.ToLower(req.Method) + "_" + name
+	}
+	return filepath.Join(account, name, platform)
+}
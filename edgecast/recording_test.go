@@ -0,0 +1,79 @@
+package edgecast
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordingPath(t *testing.T) {
+	tests := map[string]string{
+		"GET /v2/realtimestats/customers/ABCD/media/3/bandwidth":                        "ABCD/bandwidth/3",
+		"GET /v1/reporting/customers/ABCD/media/8/cnamereport?begindate=x":              "ABCD/cnamereport/8",
+		"GET /v1/reporting/customers/ABCD/bytestransferred/interval?mediatypeid=14&x=y": "ABCD/bytestransferred_interval/14",
+		"GET /v2/mcc/customers/ABCD/edge/purge?page=1":                                  "ABCD/edge_purge/0",
+		"PUT /v2/mcc/customers/ABCD/edge/purge":                                         "ABCD/put_edge_purge/0",
+	}
+	for request, want := range tests {
+		parts := strings.SplitN(request, " ", 2)
+		req, err := http.NewRequest(parts[0], "https://api.edgecast.com"+parts[1], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := recordingPath(req); got != filepath.FromSlash(want) {
+			t.Errorf("recordingPath(%s) = %q, want %q", request, got, want)
+		}
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	responses := []string{`{"Result": 1.5}`, `{"Result": 2.5}`}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if len(responses) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(responses[0]))
+		responses = responses[1:]
+	})
+	c.SetHTTPClient(&http.Client{Transport: NewRecorder(dir, http.DefaultTransport, func(err error) { t.Error(err) })})
+	for i := 0; i < 3; i++ {
+		_, _ = c.Bandwidth(context.Background(), MediaTypeLarge)
+		time.Sleep(time.Millisecond) // keep the timestamps of the recordings apart
+	}
+
+	// replay without any server, including the recorded server error
+	replay := NewClient("ABCD", "secret").SetBaseURL("http://127.0.0.1:0/v2/realtimestats").SetRetries(1)
+	replay.SetHTTPClient(&http.Client{Transport: NewReplayer(dir)})
+	for i, want := range []float64{1.5, 2.5} {
+		got, err := replay.Bandwidth(context.Background(), MediaTypeLarge)
+		if err != nil {
+			t.Fatalf("replay %d: %v", i, err)
+		}
+		if got.Bps != want {
+			t.Errorf("replay %d: Bandwidth() = %v, want %v", i, got.Bps, want)
+		}
+	}
+	for i := 0; i < 2; i++ { // the last recording is repeated
+		if _, err := replay.Bandwidth(context.Background(), MediaTypeLarge); !isServerError(err) {
+			t.Errorf("replay of the server error returned %v, want a ServerError", err)
+		}
+	}
+	if _, err := replay.Connections(context.Background(), MediaTypeLarge); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("replay without recording returned %v, want 404", err)
+	}
+}
+
+func isServerError(err error) bool {
+	_, ok := err.(*ServerError)
+	return ok
+}
+
+func isStatus(err error, code int) bool {
+	e, ok := err.(*StatusError)
+	return ok && e.StatusCode == code
+}
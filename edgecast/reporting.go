@@ -0,0 +1,101 @@
+package edgecast
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	// DefaultReportingURL holds the URL of the Edgecast reporting API
+	DefaultReportingURL = "https://api.edgecast.com/v2/reporting"
+
+	// MethodDataTransferred is the endpoint for the data transferred per platform and interval
+	MethodDataTransferred = "bytestransferred/interval"
+	// MethodCNAMEReport is the endpoint for the traffic per edge CNAME
+	MethodCNAMEReport = "cnamereport"
+	// MethodOriginReport is the endpoint for the traffic per customer origin
+	MethodOriginReport = "customeroriginreport"
+
+	// reportTimeFormat is the format of the begin and end dates of a report, always in UTC
+	reportTimeFormat = "2006-01-02T15:04:05"
+)
+
+// Interval is the granularity of a report
+type Interval int
+
+// Intervals supported by the reporting API
+const (
+	IntervalHour Interval = 1
+	IntervalDay  Interval = 2
+)
+
+// Duration returns the length of the interval
+func (i Interval) Duration() time.Duration {
+	if i == IntervalDay {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+func (i Interval) String() string {
+	if i == IntervalDay {
+		return "day"
+	}
+	return "hour"
+}
+
+// ReportPeriod selects the time range of a report, from Begin (inclusive) to End (exclusive), split into intervals
+type ReportPeriod struct {
+	Begin    time.Time
+	End      time.Time
+	Interval Interval
+}
+
+// LastComplete returns the period of the latest interval that ended before the given time
+// - intervals are aligned to full hours and days in UTC
+func LastComplete(interval Interval, before time.Time) ReportPeriod {
+	end := before.UTC().Truncate(interval.Duration())
+	return ReportPeriod{Begin: end.Add(-interval.Duration()), End: end, Interval: interval}
+}
+
+// query encodes the period as query parameters of a report request
+func (p ReportPeriod) query() url.Values {
+	return url.Values{
+		"begindate": {p.Begin.UTC().Format(reportTimeFormat)},
+		"enddate":   {p.End.UTC().Format(reportTimeFormat)},
+	}
+}
+
+// DataTransferred returns the bytes transferred by the given platform per interval of the given period
+func (c *Client) DataTransferred(ctx context.Context, platform int, period ReportPeriod) (*DataTransferData, error) {
+	query := period.query()
+	query.Set("intervaltype", fmt.Sprint(int(period.Interval)))
+	query.Set("mediatypeid", fmt.Sprint(platform))
+
+	var data DataTransferData
+	if err := c.getURL(ctx, fmt.Sprintf("%s/customers/%s/%s?%s", c.ReportingURL, c.AccountID, MethodDataTransferred, query.Encode()), &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// CNAMEReport returns the traffic of the given platform per edge CNAME, summed up over the given period
+func (c *Client) CNAMEReport(ctx context.Context, platform int, period ReportPeriod) (*TrafficReportData, error) {
+	return c.trafficReport(ctx, platform, MethodCNAMEReport, period)
+}
+
+// OriginReport returns the traffic of the given platform per customer origin, summed up over the given period
+func (c *Client) OriginReport(ctx context.Context, platform int, period ReportPeriod) (*TrafficReportData, error) {
+	return c.trafficReport(ctx, platform, MethodOriginReport, period)
+}
+
+// trafficReport requests the traffic report of the given method endpoint
+func (c *Client) trafficReport(ctx context.Context, platform int, method string, period ReportPeriod) (*TrafficReportData, error) {
+	var data TrafficReportData
+	if err := c.getURL(ctx, fmt.Sprintf("%s/customers/%s/media/%d/%s?%s", c.ReportingURL, c.AccountID, platform, method, period.query().Encode()), &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
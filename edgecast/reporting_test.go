@@ -0,0 +1,89 @@
+package edgecast
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLastComplete(t *testing.T) {
+	before := time.Date(2019, 6, 1, 10, 30, 0, 0, time.UTC)
+
+	if got, want := LastComplete(IntervalHour, before), (ReportPeriod{
+		Begin: time.Date(2019, 6, 1, 9, 0, 0, 0, time.UTC), End: time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC), Interval: IntervalHour,
+	}); !reflect.DeepEqual(got, want) {
+		t.Errorf("LastComplete(hour) = %+v, want %+v", got, want)
+	}
+	if got, want := LastComplete(IntervalDay, before), (ReportPeriod{
+		Begin: time.Date(2019, 5, 31, 0, 0, 0, 0, time.UTC), End: time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC), Interval: IntervalDay,
+	}); !reflect.DeepEqual(got, want) {
+		t.Errorf("LastComplete(day) = %+v, want %+v", got, want)
+	}
+}
+
+func TestDataTransferred(t *testing.T) {
+	var gotPath, gotQuery string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		_, _ = w.Write(fixture(t, "datatransferred.json"))
+	})
+	c.SetReportingURL(c.BaseURL + "/v2/reporting/")
+
+	period := LastComplete(IntervalHour, time.Date(2019, 6, 1, 11, 0, 0, 0, time.UTC))
+	got, err := c.DataTransferred(context.Background(), MediaTypeLarge, period)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/v2/reporting/customers/ABCD/bytestransferred/interval"; gotPath != want {
+		t.Errorf("path = %q, want %q", gotPath, want)
+	}
+	if want := "begindate=2019-06-01T10%3A00%3A00&enddate=2019-06-01T11%3A00%3A00&intervaltype=1&mediatypeid=3"; gotQuery != want {
+		t.Errorf("query = %q, want %q", gotQuery, want)
+	}
+	if want := float64(1 << 30); got.Bytes() != want {
+		t.Errorf("DataTransferred().Bytes() = %g, want %g", got.Bytes(), want)
+	}
+}
+
+func TestCNAMEReport(t *testing.T) {
+	var gotPath string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_, _ = w.Write(fixture(t, "cnamereport.json"))
+	})
+	c.SetReportingURL(c.BaseURL + "/v2/reporting")
+
+	got, err := c.CNAMEReport(context.Background(), MediaTypeADN, LastComplete(IntervalDay, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/v2/reporting/customers/ABCD/media/14/cnamereport"; gotPath != want {
+		t.Errorf("path = %q, want %q", gotPath, want)
+	}
+	want := &TrafficReportData{{Name: "static.example.com", Bytes: 1 << 29, Hits: 1200}, {Name: "images.example.com", Bytes: 1 << 28, Hits: 600}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CNAMEReport() = %+v, want %+v", got, want)
+	}
+}
+
+func TestOriginReport(t *testing.T) {
+	var gotPath string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_, _ = w.Write(fixture(t, "originreport.json"))
+	})
+	c.SetReportingURL(c.BaseURL + "/v2/reporting")
+
+	got, err := c.OriginReport(context.Background(), MediaTypeSmall, LastComplete(IntervalHour, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/v2/reporting/customers/ABCD/media/8/customeroriginreport"; gotPath != want {
+		t.Errorf("path = %q, want %q", gotPath, want)
+	}
+	if want := (&TrafficReportData{{Name: "origin.example.com", Bytes: 1 << 27, Hits: 300}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("OriginReport() = %+v, want %+v", got, want)
+	}
+}
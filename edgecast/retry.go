@@ -0,0 +1,115 @@
+package edgecast
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	// RetryReasonRateLimited is reported for retries after the API throttled a request (429)
+	RetryReasonRateLimited = "rate_limited"
+	// RetryReasonServerError is reported for retries after the API failed to handle a request (5xx)
+	RetryReasonServerError = "server_error"
+	// RetryReasonNetworkError is reported for retries after a request didn't get any response
+	RetryReasonNetworkError = "network_error"
+)
+
+// RetryPolicy controls how often and how fast temporarily failing requests are retried
+// - the delay between two attempts grows exponentially from InitialBackoff up to MaxBackoff and is randomized by Jitter
+// - a Retry-After header of rate-limited or unavailable responses takes precedence over the computed delay
+// - no attempt is started after MaxElapsedTime or the deadline of the request's context
+type RetryPolicy struct {
+	MaxAttempts    int           // attempts per request including the first one
+	InitialBackoff time.Duration // delay before the first retry
+	MaxBackoff     time.Duration // upper bound of the delay between two attempts
+	Multiplier     float64       // growth factor of the delay per attempt
+	Jitter         float64       // fraction of the delay that is randomized, between 0 and 1
+	MaxElapsedTime time.Duration // upper bound of the time spent on all attempts, 0 for no bound besides the context
+}
+
+// DefaultRetryPolicy returns the retry policy used by new clients
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    DefaultRequestRetries,
+		InitialBackoff: 250 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.5,
+		MaxElapsedTime: 30 * time.Second,
+	}
+}
+
+// backoff returns the randomized delay before the given retry (starting at 1)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < retry && d < float64(p.MaxBackoff); i++ {
+		d *= p.Multiplier
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	return time.Duration(d * (1 - p.Jitter*rand.Float64()))
+}
+
+// delay returns the time to wait before retrying a request that failed with the given error
+func (p RetryPolicy) delay(retry int, err error) time.Duration {
+	switch e := err.(type) {
+	case *RateLimitError:
+		if e.RetryAfter > 0 {
+			return e.RetryAfter
+		}
+	case *ServerError:
+		if e.StatusCode == http.StatusServiceUnavailable && e.RetryAfter > 0 {
+			return e.RetryAfter
+		}
+	}
+	return p.backoff(retry)
+}
+
+// retryReason returns the reason reported for retrying a request that failed with the given error
+func retryReason(err error) string {
+	switch err.(type) {
+	case *RateLimitError:
+		return RetryReasonRateLimited
+	case *ServerError:
+		return RetryReasonServerError
+	default:
+		return RetryReasonNetworkError
+	}
+}
+
+// retryHookKey is the context key of the hook set by WithRetryHook
+type retryHookKey struct{}
+
+// WithRetryHook returns a copy of ctx that makes the client call hook with the reason before every retry of a request
+func WithRetryHook(ctx context.Context, hook func(reason string)) context.Context {
+	return context.WithValue(ctx, retryHookKey{}, hook)
+}
+
+// wait blocks before the given retry of a request that started at begin and failed with the given error
+// - returns false without waiting if the retry would start after the policy's or the context's deadline
+func (p RetryPolicy) wait(ctx context.Context, begin time.Time, retry int, err error) bool {
+	d := p.delay(retry, err)
+	next := time.Now().Add(d)
+	if p.MaxElapsedTime > 0 && next.Sub(begin) > p.MaxElapsedTime {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && next.After(deadline) {
+		return false
+	}
+
+	if hook, ok := ctx.Value(retryHookKey{}).(func(string)); ok {
+		hook(retryReason(err))
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,140 @@
+package edgecast
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     int
+		attempts int32
+	}{
+		{"server errors are retried", http.StatusInternalServerError, 3},
+		{"rate limits are retried", http.StatusTooManyRequests, 3},
+		{"auth errors are not retried", http.StatusUnauthorized, 1},
+		{"other errors are not retried", http.StatusNotFound, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(tt.code)
+			}).SetRetryPolicy(fastRetryPolicy(3))
+
+			if _, err := c.Bandwidth(context.Background(), MediaTypeLarge); err == nil {
+				t.Error("Bandwidth() error = nil, want error after exhausting retries")
+			}
+			if attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	var attempts int32
+	var reasons []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write(fixture(t, "bandwidth.json"))
+	}).SetRetryPolicy(fastRetryPolicy(5))
+
+	ctx := WithRetryHook(context.Background(), func(reason string) { reasons = append(reasons, reason) })
+	if _, err := c.Bandwidth(ctx, MediaTypeLarge); err != nil {
+		t.Fatal(err)
+	}
+	if len(reasons) != 2 || reasons[0] != RetryReasonServerError {
+		t.Errorf("retry reasons = %v, want 2x %s", reasons, RetryReasonServerError)
+	}
+}
+
+func TestRetryAfterHonored(t *testing.T) {
+	var attempts int32
+	var first time.Time
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if waited := time.Since(first); waited < time.Second {
+			t.Errorf("retried after %s, want at least 1s", waited)
+		}
+		_, _ = w.Write(fixture(t, "bandwidth.json"))
+	}).SetRetryPolicy(fastRetryPolicy(2))
+
+	if _, err := c.Bandwidth(context.Background(), MediaTypeLarge); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetryDeadline(t *testing.T) {
+	var attempts int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}).SetRetryPolicy(fastRetryPolicy(3))
+
+	// the requested delay exceeds the deadline, so the client gives up immediately
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	begin := time.Now()
+	_, err := c.Bandwidth(ctx, MediaTypeLarge)
+	if e, ok := err.(*RateLimitError); !ok || e.RetryAfter != time.Minute {
+		t.Errorf("Bandwidth() error = %#v, want *RateLimitError", err)
+	}
+	if attempts != 1 || time.Since(begin) > time.Second {
+		t.Errorf("attempts = %d after %s, want a single attempt without waiting", attempts, time.Since(begin))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2, Jitter: 0.5}
+
+	tests := []struct {
+		retry int
+		max   time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{10, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if got := p.backoff(tt.retry); got > tt.max || got < tt.max/2 {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.retry, got, tt.max/2, tt.max)
+			}
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"invalid", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	}
+
+	for _, tt := range tests {
+		if got := retryAfter(tt.value); got != tt.want {
+			t.Errorf("retryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
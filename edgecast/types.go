@@ -0,0 +1,129 @@
+package edgecast
+
+import (
+	"fmt"
+	"time"
+)
+
+// BandwidthData holds the data of a request
+// to the edgecast bandwidth API
+type BandwidthData struct {
+	Bps      float64
+	Platform int
+}
+
+// ConnectionData holds the data of a request
+// to the edgecast connections API
+type ConnectionData struct {
+	Connections float64
+	Platform    int
+}
+
+// CacheStatusData represents all fields returned from
+// a request to the /cachestatus endpoint
+type CacheStatusData []CacheStatusEntry
+
+// CacheStatusEntry holds the number of connections of a single cache status
+type CacheStatusEntry struct {
+	CacheStatus string `json:"CacheStatus"`
+	Connections int64  `json:"Connections"`
+}
+
+// StatusCodeData represents all fields returned from
+// a request to the /statuscode endpoint
+type StatusCodeData []StatusCodeEntry
+
+// StatusCodeEntry holds the number of connections of a single status code (e.g. "404") or status class (e.g. "4xx")
+type StatusCodeEntry struct {
+	Connections int64  `json:"Connections"`
+	StatusCode  string `json:"StatusCode"`
+}
+
+// RawEdgecastResult represents a raw JSON response object from the API
+type RawEdgecastResult struct {
+	Result float64
+}
+
+// DataTransferData represents all fields returned from
+// a request to the /bytestransferred/interval endpoint
+type DataTransferData []DataTransferEntry
+
+// DataTransferEntry holds the bytes transferred within a single interval, starting at Date (UTC)
+type DataTransferEntry struct {
+	Bytes float64 `json:"Bytes"`
+	Date  string  `json:"Date"`
+}
+
+// Bytes returns the bytes transferred within all intervals
+func (d DataTransferData) Bytes() float64 {
+	var bytes float64
+	for _, entry := range d {
+		bytes += entry.Bytes
+	}
+	return bytes
+}
+
+// TrafficReportData represents all fields returned from
+// a request to the /cnamereport or /customeroriginreport endpoint
+type TrafficReportData []TrafficReportEntry
+
+// TrafficReportEntry holds the traffic of a single edge CNAME or customer origin
+type TrafficReportEntry struct {
+	Name  string  `json:"Name"`
+	Bytes float64 `json:"Bytes"`
+	Hits  float64 `json:"Hits"`
+}
+
+// PurgeRequestData holds the purge requests of an account
+type PurgeRequestData []PurgeRequest
+
+// PurgeRequest represents a single purge request
+// - CompleteDate is empty while the purge is pending
+type PurgeRequest struct {
+	ID           string `json:"Id"`
+	MediaPath    string `json:"MediaPath"`
+	MediaType    int    `json:"MediaType"`
+	InDate       string `json:"InDate"`
+	CompleteDate string `json:"CompleteDate"`
+}
+
+// Pending returns whether the purge hasn't been completed yet
+func (p PurgeRequest) Pending() bool {
+	return p.CompleteDate == ""
+}
+
+// Submitted returns the time the purge was submitted
+func (p PurgeRequest) Submitted() (time.Time, error) {
+	return ParseTime(p.InDate)
+}
+
+// purgeRequestPage represents a single page of purge requests returned from
+// a request to the /edge/purge endpoint
+type purgeRequestPage struct {
+	Total int            `json:"Total"`
+	Items []PurgeRequest `json:"Items"`
+}
+
+// purgeSubmission represents the body of a request submitting a purge
+type purgeSubmission struct {
+	MediaPath string `json:"MediaPath"`
+	MediaType int    `json:"MediaType"`
+}
+
+// PurgeData holds the response to a submitted purge
+type PurgeData struct {
+	ID string `json:"Id"`
+}
+
+// timeFormats lists the formats of the dates returned by the API, which are in UTC unless they carry a zone
+var timeFormats = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05"}
+
+// ParseTime parses a date returned by the API
+func ParseTime(s string) (time.Time, error) {
+	for _, format := range timeFormats {
+		if t, err := time.ParseInLocation(format, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("edgecast: invalid date %q", s)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-kit/kit/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/trivago/exporter-edgecast/edgecast"
+)
+
+// serviceMetrics holds the instruments of the middlewares
+// - they are created once and shared by the services of every loaded configuration, so reloads keep their values
+type serviceMetrics struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	requestGauge   metrics.Gauge
+	retryCount     metrics.Counter
+	limiterWait    metrics.Histogram
+	circuitState   metrics.Gauge
+	tokenLoaded    metrics.Gauge
+}
+
+/*
+ * exporter holds everything built from a single configuration:
+ * - the limiters, circuit breakers and token files of all accounts and secrets, shared by their pollers and probes
+ * - the HTTP client recording or replaying the responses of the Edgecast API, if requested
+ * - a poller and a collector per account, serving the metrics on /metrics
+ * - a report poller and a report collector per account if fetching reports is enabled
+ * - a purge poller and a purge collector per account if tracking purges is enabled
+ * A reload builds a new exporter next to the current one and stops the current one once the new one took over.
+ */
+type exporter struct {
+	cfg        *Config
+	logger     log.Logger
+	metrics    serviceMetrics
+	collectors EdgecastCollectors
+	reports    []*ReportCollector
+	purges     []*PurgeCollector
+
+	globalLimiter   *edgecast.Limiter
+	accountLimiters map[string]*edgecast.Limiter
+	accountBreakers map[string]*circuitBreakers
+	tokenFiles      map[string]*tokenFile
+	platformCaches  map[string]*platformCache
+	httpClient      *http.Client // records or replays the responses of the Edgecast API, nil to use the default
+
+	cancel  context.CancelFunc // stops the pollers
+	pollers sync.WaitGroup
+}
+
+// newExporter builds the services and collectors of all accounts of the given configuration and starts their pollers
+// - the pollers run until ctx is done or stop() is called
+// - accounts that were already polled by prev start with its latest results, so a reload doesn't leave gaps
+// - the platforms of accounts selecting auto are discovered before, which blocks until the API answered or the discovery timeout passed
+// - the outcome of a discovery that finished in time is reused by the probes of the account
+// - platforms without any selected metric type are neither discovered nor polled
+func newExporter(ctx context.Context, cfg *Config, m serviceMetrics, logger log.Logger, prev *exporter) *exporter {
+	e := &exporter{
+		cfg:     cfg,
+		logger:  logger,
+		metrics: m,
+
+		// limit the requests of all accounts together and of every single account, including its probes
+		globalLimiter:   cfg.RateLimit.limiter("global"),
+		accountLimiters: make(map[string]*edgecast.Limiter),
+		// stop calling the API for method/platform pairs of an account that keep failing
+		accountBreakers: make(map[string]*circuitBreakers),
+		// read tokens from files again whenever they change
+		tokenFiles: make(map[string]*tokenFile),
+		// remember the discovered platforms, so probes selecting auto don't query every platform again
+		platformCaches: make(map[string]*platformCache),
+	}
+	for _, account := range cfg.Secrets {
+		e.addAccount(account)
+	}
+	for _, account := range cfg.Accounts {
+		e.addAccount(account)
+	}
+	e.httpClient = e.newHTTPClient(prev)
+
+	ctx, e.cancel = context.WithCancel(ctx)
+
+	// discover the platforms of all accounts concurrently, which selected auto
+	// - bounded by the discovery timeout, so a slow API delays neither the startup nor a reload for long
+	discoveryCtx, cancelDiscovery := context.WithTimeout(ctx, cfg.DiscoveryTimeout)
+	defer cancelDiscovery()
+	services := make([]EdgecastInterface, len(cfg.Accounts))
+	selections := make([]metricSelection, len(cfg.Accounts))
+	var discovery sync.WaitGroup
+	for i, account := range cfg.Accounts {
+		services[i] = e.newService(account)
+		platforms, auto := cfg.platforms(account)
+		selections[i] = cfg.metrics(account, platforms)
+		if auto {
+			discovery.Add(1)
+			go func(i int, cache *platformCache) {
+				defer discovery.Done()
+				selections[i] = selections[i].restrict(cache.discover(discoveryCtx, services[i], selections[i].platforms()))
+			}(i, e.platformCaches[account.label()])
+		}
+	}
+	discovery.Wait()
+
+	// scrape every configured account using its own client, poller and collector
+	e.collectors = make(EdgecastCollectors, 0, len(cfg.Accounts))
+	for i, account := range cfg.Accounts {
+		svc := services[i]
+		if len(selections[i]) == 0 {
+			_ = level.Warn(logger).Log("msg", "no active platforms", "account", account.label())
+		} else {
+			_ = level.Info(logger).Log("msg", "active platforms", "account", account.label(), "platforms", platformList(selections[i].platforms()))
+		}
+
+		// refresh all metrics in the background, so scrapes never wait for the Edgecast API
+		poller := NewPoller(&svc, selections[i], cfg.PollInterval)
+		if prev != nil {
+			if col := prev.collector(account.label()); col != nil {
+				poller.seed(col.poller.snapshot())
+			}
+		}
+		e.pollers.Add(1)
+		go func() {
+			defer e.pollers.Done()
+			poller.Run(ctx)
+		}()
+
+		// create the prometheus collector that serves the poller's snapshot
+		e.collectors = append(e.collectors, NewPollingEdgecastCollector(account.label(), poller, cfg.collectorOptions()))
+
+		// fetch the reports of the active platforms on their own, slower schedule
+		if cfg.Reporting.Enabled {
+			reports := NewReportPoller(&svc, selections[i].platforms(), cfg.Reporting)
+			if prev != nil {
+				if col := prev.reportCollector(account.label()); col != nil {
+					reports.seed(col.poller.snapshot())
+				}
+			}
+			e.pollers.Add(1)
+			go func() {
+				defer e.pollers.Done()
+				reports.Run(ctx)
+			}()
+			e.reports = append(e.reports, NewReportCollector(account.label(), reports))
+		}
+
+		// track the purge requests of the account on their own schedule
+		if cfg.Purges.Enabled {
+			purges := NewPurgePoller(&svc, cfg.Purges)
+			if prev != nil {
+				if col := prev.purgeCollector(account.label()); col != nil {
+					purges.seed(col.poller.snapshot())
+				}
+			}
+			e.pollers.Add(1)
+			go func() {
+				defer e.pollers.Done()
+				purges.Run(ctx)
+			}()
+			e.purges = append(e.purges, NewPurgeCollector(account.label(), purges))
+		}
+	}
+	return e
+}
+
+// addAccount creates the limiter, the circuit breakers, the platform cache and the token file of an account or secret, all looked up by its label
+func (e *exporter) addAccount(account AccountConfig) {
+	e.platformCaches[account.label()] = newPlatformCache(e.cfg.DiscoveryTTL)
+	e.accountLimiters[account.label()] = account.RateLimit.limiter("account")
+	e.accountBreakers[account.label()] = newCircuitBreakers(e.cfg.CircuitBreaker.FailureThreshold, e.cfg.CircuitBreaker.OpenTimeout)
+	if account.TokenFile != "" {
+		tokens := newTokenFile(account.label(), account.TokenFile, e.metrics.tokenLoaded)
+		_, _ = tokens.Token() // load eagerly, so the load is exported right away
+		e.tokenFiles[account.label()] = tokens
+	}
+}
+
+// newService creates the EdgecastClient of an account that communicates with the Edgecast API
+func (e *exporter) newService(account AccountConfig) EdgecastInterface {
+	client := edgecast.NewClient(account.ID, account.Token).
+		SetBaseURL(e.cfg.Client.BaseURL).
+		SetReportingURL(e.cfg.Reporting.BaseURL).
+		SetMCCURL(e.cfg.Purges.BaseURL).
+		SetRetryPolicy(e.cfg.Client.retryPolicy()).
+		SetTimeout(e.cfg.Client.Timeout).
+		SetLimiters(e.accountLimiters[account.label()], e.globalLimiter)
+	if tokens, ok := e.tokenFiles[account.label()]; ok {
+		client.SetTokenSource(tokens)
+	}
+	if e.httpClient != nil {
+		client.SetHTTPClient(e.httpClient)
+	}
+	var svc EdgecastInterface = client
+	// attach circuit breaker to service
+	if e.cfg.CircuitBreaker.FailureThreshold > 0 {
+		svc = circuitBreakerMiddleware{account.label(), e.accountBreakers[account.label()], e.metrics.circuitState, svc}
+	}
+	// attach logger to service
+	svc = loggingMiddleware{account.label(), e.logger, svc}
+	// attach instrumenting middleware
+	svc = instrumentingMiddleware{account.label(), e.metrics.requestCount, e.metrics.requestLatency, e.metrics.requestGauge, e.metrics.retryCount, e.metrics.limiterWait, svc}
+	return svc
+}
+
+// newHTTPClient creates the HTTP client that records or replays the responses of the Edgecast API as configured, nil if neither is
+// - the client of prev is kept if its directories didn't change, so a reload doesn't restart a replay from the beginning
+func (e *exporter) newHTTPClient(prev *exporter) *http.Client {
+	record, replay := e.cfg.Client.RecordDir, e.cfg.Client.ReplayDir
+	switch {
+	case prev != nil && prev.cfg.Client.RecordDir == record && prev.cfg.Client.ReplayDir == replay:
+		return prev.httpClient
+	case replay != "":
+		_ = level.Warn(e.logger).Log("msg", "replaying recorded responses instead of querying the Edgecast API", "dir", replay)
+		return &http.Client{Transport: edgecast.NewReplayer(replay)}
+	case record != "":
+		_ = level.Info(e.logger).Log("msg", "recording all responses of the Edgecast API", "dir", record)
+		logger := e.logger
+		return &http.Client{Transport: edgecast.NewRecorder(record, http.DefaultTransport, func(err error) {
+			_ = level.Warn(logger).Log("msg", "saving a response of the Edgecast API failed", "err", err)
+		})}
+	default:
+		return nil
+	}
+}
+
+// collector returns the collector of the account with the given label, nil if there is none
+func (e *exporter) collector(account string) *EdgecastCollector {
+	for _, col := range e.collectors {
+		if col.account == account {
+			return col
+		}
+	}
+	return nil
+}
+
+// reportCollector returns the report collector of the account with the given label, nil if there is none
+func (e *exporter) reportCollector(account string) *ReportCollector {
+	for _, col := range e.reports {
+		if col.account == account {
+			return col
+		}
+	}
+	return nil
+}
+
+// purgeCollector returns the purge collector of the account with the given label, nil if there is none
+func (e *exporter) purgeCollector(account string) *PurgeCollector {
+	for _, col := range e.purges {
+		if col.account == account {
+			return col
+		}
+	}
+	return nil
+}
+
+// Describe describes the metrics of all collectors of the exporter
+// - implements function of interface prometheus.Collector
+func (e *exporter) Describe(ch chan<- *prometheus.Desc) {
+	e.collectors.Describe(ch)
+	for _, col := range e.reports {
+		col.Describe(ch)
+	}
+	for _, col := range e.purges {
+		col.Describe(ch)
+	}
+}
+
+// Collect collects the metrics of all collectors of the exporter
+// - implements function of interface prometheus.Collector
+func (e *exporter) Collect(ch chan<- prometheus.Metric) {
+	e.collectors.Collect(ch)
+	for _, col := range e.reports {
+		col.Collect(ch)
+	}
+	for _, col := range e.purges {
+		col.Collect(ch)
+	}
+}
+
+// stop cancels the pollers, including their outstanding requests, and waits for them to return
+func (e *exporter) stop() {
+	e.cancel()
+	e.pollers.Wait()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestExporter builds the exporter of cfg with discarded metrics and stops it once the test finished
+// - if cfg has neither accounts nor secrets, the secret "main" of account ABCD is added, so only services can be created
+func newTestExporter(t *testing.T, cfg *Config) *exporter {
+	if len(cfg.Accounts) == 0 && len(cfg.Secrets) == 0 {
+		cfg.Secrets = []AccountConfig{{ID: "ABCD", Token: "secret", Name: "main"}}
+	}
+	e := newExporter(context.Background(), cfg, discardMetrics(), log.NewNopLogger(), nil)
+	t.Cleanup(e.stop)
+	return e
+}
+
+// discardMetrics returns service metrics discarding all values
+func discardMetrics() serviceMetrics {
+	return serviceMetrics{discard.NewCounter(), discard.NewHistogram(), discard.NewGauge(), discard.NewCounter(), discard.NewHistogram(), discard.NewGauge(), discard.NewGauge()}
+}
+
+func TestAccountLabels(t *testing.T) {
+	// every account gets its own bandwidth, so mixed up clients show up as wrong values
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/customers/ABCD/") {
+			_, _ = w.Write([]byte(`{"Result": 1.5}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"Result": 2.5}`))
+	}))
+	defer api.Close()
+
+	cfg := DefaultConfig()
+	cfg.Client.BaseURL = api.URL
+	cfg.Metrics = []string{metricBandwidth}
+	cfg.Platforms = PlatformList{"http_large"}
+	cfg.Accounts = []AccountConfig{
+		{ID: "ABCD", Token: "secret", Name: "main"},
+		{ID: "EFGH", Token: "secret", Platforms: PlatformList{"http_large", "http_small"}},
+	}
+	e := newTestExporter(t, &cfg)
+	for _, col := range e.collectors {
+		col.poller.poll(context.Background())
+	}
+
+	want := `
+# HELP edgecast_bandwidth_bits_per_second Current bandwidth usage per platform in bits per second.
+# TYPE edgecast_bandwidth_bits_per_second gauge
+edgecast_bandwidth_bits_per_second{account="EFGH",platform="http_large"} 2.5
+edgecast_bandwidth_bits_per_second{account="EFGH",platform="http_small"} 2.5
+edgecast_bandwidth_bits_per_second{account="main",platform="http_large"} 1.5
+# HELP edgecast_up Whether the last fetch from the Edgecast API succeeded for at least one platform and metric type.
+# TYPE edgecast_up gauge
+edgecast_up{account="EFGH"} 1
+edgecast_up{account="main"} 1
+`
+	if err := testutil.CollectAndCompare(e, strings.NewReader(want), "edgecast_bandwidth_bits_per_second", "edgecast_up"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAccountLimiterIsolation(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Result": 1.5}`))
+	}))
+	defer api.Close()
+
+	cfg := DefaultConfig()
+	cfg.Client.BaseURL = api.URL
+	cfg.RateLimit = RateLimitConfig{MaxInFlight: 1}
+	cfg.Secrets = []AccountConfig{
+		{ID: "SLOW", Token: "secret", Name: "throttled", RateLimit: RateLimitConfig{RequestsPerSecond: 0.5, Burst: 1}},
+		{ID: "FAST", Token: "secret", Name: "other"},
+	}
+	e := newTestExporter(t, &cfg)
+	throttled, other := e.newService(cfg.Secrets[0]), e.newService(cfg.Secrets[1])
+
+	// the throttled account uses up its burst and keeps waiting 2s for every further token
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		go func() { _, _ = throttled.Bandwidth(ctx, 3) }()
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	begin := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := other.Bandwidth(context.Background(), 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+		t.Errorf("3 requests of another account took %s while the throttled account waited for its rate limit, want less than 500ms", elapsed)
+	}
+}
+
+// TestPlatformsEnv guards against EDGECAST_PLATFORMS being ignored, which once left all platforms scraped
+func TestPlatformsEnv(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Result": 1.5}`))
+	}))
+	defer api.Close()
+
+	cfg := DefaultConfig()
+	cfg.Client.BaseURL = api.URL
+	env := map[string]string{"EDGECAST_ACCOUNT_ID": "ABCD", "EDGECAST_TOKEN": "secret", "EDGECAST_PLATFORMS": "http_large, 14"}
+	if errs := cfg.applyEnv(func(key string) string { return env[key] }); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	e := newTestExporter(t, &cfg)
+
+	want := map[int]string{3: "http_large", 14: "adn"}
+	if got := e.collectors[0].metrics.platforms(); !reflect.DeepEqual(got, want) {
+		t.Errorf("scraped platforms = %v, want %v", got, want)
+	}
+}
+
+func TestDiscoveryTimeout(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done() // never answers
+	}))
+	defer api.Close()
+
+	cfg := DefaultConfig()
+	cfg.Client.BaseURL = api.URL
+	cfg.Accounts = []AccountConfig{{ID: "ABCD", Token: "secret", Platforms: PlatformList{platformsAuto}}}
+	cfg.DiscoveryTimeout = 50 * time.Millisecond
+
+	begin := time.Now()
+	e := newTestExporter(t, &cfg)
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("newExporter() took %s with a discovery timeout of 50ms", elapsed)
+	}
+	if got := len(e.collectors[0].metrics); got != len(Platforms) {
+		t.Errorf("kept %d platforms, want all %d that didn't answer in time", got, len(Platforms))
+	}
+}
@@ -1,71 +1,156 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/go-kit/kit/metrics"
-	"github.com/mre/edgecast"
+	"github.com/trivago/exporter-edgecast/edgecast"
 )
 
 /*
  * instrumentingMiddleware wraps a given EdgecastInterface an creates metrics for its invoked functions
- * The following metrics are created per function:
+ * The following metrics are created per function and labeled with the account of the wrapped client:
  * - requestCount:					incremented on every invocation of that function
  * - requestLatency:				time in seconds that function took from invocation to return
  * - requestLatencyDistribution:	histogram distribution of all invocations so far including phi-quantiles, total, sum
+ * - retryCount:					incremented on every retry of an API request made by that function, per reason
+ * - limiterWait:					time in seconds API requests made by that function waited for a rate limiter, per limiter
  */
 type instrumentingMiddleware struct {
+	account                    string
 	requestCount               metrics.Counter   // positive/incrementing only value
 	requestLatencyDistribution metrics.Histogram // bucket sampling
 	requestLatency             metrics.Gauge     // positive and negative counting value
+	retryCount                 metrics.Counter   // positive/incrementing only value
+	limiterWait                metrics.Histogram // bucket sampling
 	next                       EdgecastInterface
 }
 
-func (mw instrumentingMiddleware) Bandwidth(platform int) (bandwidthData *edgecast.BandwidthData, err error) {
+func (mw instrumentingMiddleware) Bandwidth(ctx context.Context, platform int) (bandwidthData *edgecast.BandwidthData, err error) {
 	defer func(begin time.Time) {
-		lvs := []string{"method", "Bandwidth", "error", fmt.Sprint(err != nil)}
+		lvs := []string{"account", mw.account, "method", "Bandwidth", "error", fmt.Sprint(err != nil)}
 		mw.requestCount.With(lvs...).Add(1)
 		mw.requestLatencyDistribution.With(lvs...).Observe(time.Since(begin).Seconds())
 		mw.requestLatency.With(lvs...).Set(time.Since(begin).Seconds())
 	}(time.Now())
 
-	bandwidthData, err = mw.next.Bandwidth(platform) // hand request to logged service
+	ctx = mw.hooks(ctx, "Bandwidth")
+	bandwidthData, err = mw.next.Bandwidth(ctx, platform) // hand request to logged service
 	return
 }
 
-func (mw instrumentingMiddleware) Connections(platform int) (connectionData *edgecast.ConnectionData, err error) {
+func (mw instrumentingMiddleware) Connections(ctx context.Context, platform int) (connectionData *edgecast.ConnectionData, err error) {
 	defer func(begin time.Time) {
-		lvs := []string{"method", "Connections", "error", fmt.Sprint(err != nil)}
+		lvs := []string{"account", mw.account, "method", "Connections", "error", fmt.Sprint(err != nil)}
 		mw.requestCount.With(lvs...).Add(1)
 		mw.requestLatencyDistribution.With(lvs...).Observe(time.Since(begin).Seconds())
 		mw.requestLatency.With(lvs...).Set(time.Since(begin).Seconds())
 	}(time.Now())
 
-	connectionData, err = mw.next.Connections(platform) // hand request to logged service
+	ctx = mw.hooks(ctx, "Connections")
+	connectionData, err = mw.next.Connections(ctx, platform) // hand request to logged service
 	return
 }
 
-func (mw instrumentingMiddleware) CacheStatus(platform int) (cacheStatusData *edgecast.CacheStatusData, err error) {
+func (mw instrumentingMiddleware) CacheStatus(ctx context.Context, platform int) (cacheStatusData *edgecast.CacheStatusData, err error) {
 	defer func(begin time.Time) {
-		lvs := []string{"method", "CacheStatus", "error", fmt.Sprint(err != nil)}
+		lvs := []string{"account", mw.account, "method", "CacheStatus", "error", fmt.Sprint(err != nil)}
 		mw.requestCount.With(lvs...).Add(1)
 		mw.requestLatencyDistribution.With(lvs...).Observe(time.Since(begin).Seconds())
 		mw.requestLatency.With(lvs...).Set(time.Since(begin).Seconds())
 	}(time.Now())
 
-	cacheStatusData, err = mw.next.CacheStatus(platform) // hand request to logged service
+	ctx = mw.hooks(ctx, "CacheStatus")
+	cacheStatusData, err = mw.next.CacheStatus(ctx, platform) // hand request to logged service
 	return
 }
 
-func (mw instrumentingMiddleware) StatusCodes(platform int) (statusCodeData *edgecast.StatusCodeData, err error) {
+func (mw instrumentingMiddleware) StatusCodes(ctx context.Context, platform int) (statusCodeData *edgecast.StatusCodeData, err error) {
 	defer func(begin time.Time) {
-		lvs := []string{"method", "StatusCodes", "error", fmt.Sprint(err != nil)}
+		lvs := []string{"account", mw.account, "method", "StatusCodes", "error", fmt.Sprint(err != nil)}
 		mw.requestCount.With(lvs...).Add(1)
 		mw.requestLatencyDistribution.With(lvs...).Observe(time.Since(begin).Seconds())
 		mw.requestLatency.With(lvs...).Set(time.Since(begin).Seconds())
 	}(time.Now())
 
-	statusCodeData, err = mw.next.StatusCodes(platform) // hand request to logged service
+	ctx = mw.hooks(ctx, "StatusCodes")
+	statusCodeData, err = mw.next.StatusCodes(ctx, platform) // hand request to logged service
 	return
 }
+
+func (mw instrumentingMiddleware) DataTransferred(ctx context.Context, platform int, period edgecast.ReportPeriod) (dataTransferData *edgecast.DataTransferData, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"account", mw.account, "method", "DataTransferred", "error", fmt.Sprint(err != nil)}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatencyDistribution.With(lvs...).Observe(time.Since(begin).Seconds())
+		mw.requestLatency.With(lvs...).Set(time.Since(begin).Seconds())
+	}(time.Now())
+
+	ctx = mw.hooks(ctx, "DataTransferred")
+	dataTransferData, err = mw.next.DataTransferred(ctx, platform, period) // hand request to logged service
+	return
+}
+
+func (mw instrumentingMiddleware) CNAMEReport(ctx context.Context, platform int, period edgecast.ReportPeriod) (cnameReportData *edgecast.TrafficReportData, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"account", mw.account, "method", "CNAMEReport", "error", fmt.Sprint(err != nil)}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatencyDistribution.With(lvs...).Observe(time.Since(begin).Seconds())
+		mw.requestLatency.With(lvs...).Set(time.Since(begin).Seconds())
+	}(time.Now())
+
+	ctx = mw.hooks(ctx, "CNAMEReport")
+	cnameReportData, err = mw.next.CNAMEReport(ctx, platform, period) // hand request to logged service
+	return
+}
+
+func (mw instrumentingMiddleware) OriginReport(ctx context.Context, platform int, period edgecast.ReportPeriod) (originReportData *edgecast.TrafficReportData, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"account", mw.account, "method", "OriginReport", "error", fmt.Sprint(err != nil)}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatencyDistribution.With(lvs...).Observe(time.Since(begin).Seconds())
+		mw.requestLatency.With(lvs...).Set(time.Since(begin).Seconds())
+	}(time.Now())
+
+	ctx = mw.hooks(ctx, "OriginReport")
+	originReportData, err = mw.next.OriginReport(ctx, platform, period) // hand request to logged service
+	return
+}
+
+func (mw instrumentingMiddleware) PurgeRequests(ctx context.Context, since time.Time) (purgeRequestData *edgecast.PurgeRequestData, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"account", mw.account, "method", "PurgeRequests", "error", fmt.Sprint(err != nil)}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatencyDistribution.With(lvs...).Observe(time.Since(begin).Seconds())
+		mw.requestLatency.With(lvs...).Set(time.Since(begin).Seconds())
+	}(time.Now())
+
+	ctx = mw.hooks(ctx, "PurgeRequests")
+	purgeRequestData, err = mw.next.PurgeRequests(ctx, since) // hand request to logged service
+	return
+}
+
+func (mw instrumentingMiddleware) Purge(ctx context.Context, platform int, path string) (purgeData *edgecast.PurgeData, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"account", mw.account, "method", "Purge", "error", fmt.Sprint(err != nil)}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatencyDistribution.With(lvs...).Observe(time.Since(begin).Seconds())
+		mw.requestLatency.With(lvs...).Set(time.Since(begin).Seconds())
+	}(time.Now())
+
+	ctx = mw.hooks(ctx, "Purge")
+	purgeData, err = mw.next.Purge(ctx, platform, path) // hand request to logged service
+	return
+}
+
+// hooks returns a copy of ctx that makes the client report the retries and limiter waits of the given function
+func (mw instrumentingMiddleware) hooks(ctx context.Context, method string) context.Context {
+	ctx = edgecast.WithRetryHook(ctx, func(reason string) {
+		mw.retryCount.With("account", mw.account, "method", method, "reason", reason).Add(1)
+	})
+	return edgecast.WithWaitHook(ctx, func(limiter string, waited time.Duration) {
+		mw.limiterWait.With("account", mw.account, "method", method, "limiter", limiter).Observe(waited.Seconds())
+	})
+}
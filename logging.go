@@ -1,30 +1,34 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/go-kit/kit/log"
-	ec "github.com/mre/edgecast"
+	ec "github.com/trivago/exporter-edgecast/edgecast"
 )
 
 /*
  * loggingMiddleware wraps a given EdgecastInterface and logs its functions.
  * It logs information for the following keys:
+ * - account:	the account of the wrapped client
  * - method: 	the function that was called inside the given EdgecastInterface
  * - output: 	the return data of that function
  * - err:		the returned error-value of that function
  * - took:		time in seconds that function needed from invocation to return
  */
 type loggingMiddleware struct {
-	logger log.Logger
-	next   EdgecastInterface
+	account string
+	logger  log.Logger
+	next    EdgecastInterface
 }
 
-func (mw loggingMiddleware) Bandwidth(platform int) (bandwidthData *ec.BandwidthData, err error) {
+func (mw loggingMiddleware) Bandwidth(ctx context.Context, platform int) (bandwidthData *ec.BandwidthData, err error) {
 
 	defer func(begin time.Time) {
 		_ = mw.logger.Log( // params: alternating key-value-key-value-...
+			"account", mw.account,
 			"method", "Bandwidth",
 			"platform", fmt.Sprintf("%d(%s)", platform, Platforms[platform]),
 			"output", fmt.Sprintf("%+v", bandwidthData),
@@ -33,13 +37,14 @@ func (mw loggingMiddleware) Bandwidth(platform int) (bandwidthData *ec.Bandwidth
 		)
 	}(time.Now())
 
-	bandwidthData, err = mw.next.Bandwidth(platform) // hand function call to service
+	bandwidthData, err = mw.next.Bandwidth(ctx, platform) // hand function call to service
 	return
 }
 
-func (mw loggingMiddleware) Connections(platform int) (connectionData *ec.ConnectionData, err error) {
+func (mw loggingMiddleware) Connections(ctx context.Context, platform int) (connectionData *ec.ConnectionData, err error) {
 	defer func(begin time.Time) {
 		_ = mw.logger.Log( // params: alternating key-value-key-value-...
+			"account", mw.account,
 			"method", "Connections",
 			"platform", fmt.Sprintf("%d(%s)", platform, Platforms[platform]),
 			"output", fmt.Sprintf("%+v", connectionData),
@@ -48,13 +53,14 @@ func (mw loggingMiddleware) Connections(platform int) (connectionData *ec.Connec
 		)
 	}(time.Now())
 
-	connectionData, err = mw.next.Connections(platform) // hand function call to service
+	connectionData, err = mw.next.Connections(ctx, platform) // hand function call to service
 	return
 }
 
-func (mw loggingMiddleware) CacheStatus(platform int) (cacheStatusData *ec.CacheStatusData, err error) {
+func (mw loggingMiddleware) CacheStatus(ctx context.Context, platform int) (cacheStatusData *ec.CacheStatusData, err error) {
 	defer func(begin time.Time) {
 		_ = mw.logger.Log( // params: alternating key-value-key-value-...
+			"account", mw.account,
 			"method", "CacheStatus",
 			"platform", fmt.Sprintf("%d(%s)", platform, Platforms[platform]),
 			"output", fmt.Sprintf("%+v", cacheStatusData),
@@ -63,13 +69,14 @@ func (mw loggingMiddleware) CacheStatus(platform int) (cacheStatusData *ec.Cache
 		)
 	}(time.Now())
 
-	cacheStatusData, err = mw.next.CacheStatus(platform) // hand function call to service
+	cacheStatusData, err = mw.next.CacheStatus(ctx, platform) // hand function call to service
 	return
 }
 
-func (mw loggingMiddleware) StatusCodes(platform int) (statusCodeData *ec.StatusCodeData, err error) {
+func (mw loggingMiddleware) StatusCodes(ctx context.Context, platform int) (statusCodeData *ec.StatusCodeData, err error) {
 	defer func(begin time.Time) {
 		_ = mw.logger.Log( // params: alternating key-value-key-value-...
+			"account", mw.account,
 			"method", "StatusCodes",
 			"platform", fmt.Sprintf("%d(%s)", platform, Platforms[platform]),
 			"output", fmt.Sprintf("%+v", statusCodeData),
@@ -78,6 +85,94 @@ func (mw loggingMiddleware) StatusCodes(platform int) (statusCodeData *ec.Status
 		)
 	}(time.Now())
 
-	statusCodeData, err = mw.next.StatusCodes(platform) // hand function call to service
+	statusCodeData, err = mw.next.StatusCodes(ctx, platform) // hand function call to service
+	return
+}
+
+func (mw loggingMiddleware) DataTransferred(ctx context.Context, platform int, period ec.ReportPeriod) (dataTransferData *ec.DataTransferData, err error) {
+	defer func(begin time.Time) {
+		_ = mw.logger.Log( // params: alternating key-value-key-value-...
+			"account", mw.account,
+			"method", "DataTransferred",
+			"platform", fmt.Sprintf("%d(%s)", platform, Platforms[platform]),
+			"period", fmt.Sprintf("%s/%s", period.Begin.Format(time.RFC3339), period.End.Format(time.RFC3339)),
+			"output", fmt.Sprintf("%+v", dataTransferData),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	dataTransferData, err = mw.next.DataTransferred(ctx, platform, period) // hand function call to service
+	return
+}
+
+func (mw loggingMiddleware) CNAMEReport(ctx context.Context, platform int, period ec.ReportPeriod) (cnameReportData *ec.TrafficReportData, err error) {
+	defer func(begin time.Time) {
+		_ = mw.logger.Log( // params: alternating key-value-key-value-...
+			"account", mw.account,
+			"method", "CNAMEReport",
+			"platform", fmt.Sprintf("%d(%s)", platform, Platforms[platform]),
+			"period", fmt.Sprintf("%s/%s", period.Begin.Format(time.RFC3339), period.End.Format(time.RFC3339)),
+			"output", fmt.Sprintf("%+v", cnameReportData),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	cnameReportData, err = mw.next.CNAMEReport(ctx, platform, period) // hand function call to service
+	return
+}
+
+func (mw loggingMiddleware) OriginReport(ctx context.Context, platform int, period ec.ReportPeriod) (originReportData *ec.TrafficReportData, err error) {
+	defer func(begin time.Time) {
+		_ = mw.logger.Log( // params: alternating key-value-key-value-...
+			"account", mw.account,
+			"method", "OriginReport",
+			"platform", fmt.Sprintf("%d(%s)", platform, Platforms[platform]),
+			"period", fmt.Sprintf("%s/%s", period.Begin.Format(time.RFC3339), period.End.Format(time.RFC3339)),
+			"output", fmt.Sprintf("%+v", originReportData),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	originReportData, err = mw.next.OriginReport(ctx, platform, period) // hand function call to service
+	return
+}
+
+func (mw loggingMiddleware) PurgeRequests(ctx context.Context, since time.Time) (purgeRequestData *ec.PurgeRequestData, err error) {
+	defer func(begin time.Time) {
+		var purges int
+		if purgeRequestData != nil {
+			purges = len(*purgeRequestData)
+		}
+		_ = mw.logger.Log( // params: alternating key-value-key-value-...
+			"account", mw.account,
+			"method", "PurgeRequests",
+			"since", since.Format(time.RFC3339),
+			"purges", purges, // the requests themselves would flood the log
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	purgeRequestData, err = mw.next.PurgeRequests(ctx, since) // hand function call to service
+	return
+}
+
+func (mw loggingMiddleware) Purge(ctx context.Context, platform int, path string) (purgeData *ec.PurgeData, err error) {
+	defer func(begin time.Time) {
+		_ = mw.logger.Log( // params: alternating key-value-key-value-...
+			"account", mw.account,
+			"method", "Purge",
+			"platform", fmt.Sprintf("%d(%s)", platform, Platforms[platform]),
+			"path", path,
+			"output", fmt.Sprintf("%+v", purgeData),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+
+	purgeData, err = mw.next.Purge(ctx, platform, path) // hand function call to service
 	return
 }
@@ -2,23 +2,29 @@ package main
 
 import (
 	// general
-	"errors"
+	"context"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
-
-	// Edgecast Client
-	"github.com/mre/edgecast"
+	"syscall"
+	"time"
 
 	// Prometheus for logging/metrics
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 
 	// go-kit
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/multi"
 	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	toolkitlevel "github.com/go-kit/log/level"
 )
 
 var (
@@ -33,83 +39,237 @@ var (
 		15: "ssl_adn",
 	}
 
-	// user-defined environment-variables that handle access to the API
-	accountID    = os.Getenv("EDGECAST_ACCOUNT_ID")
-	token        = os.Getenv("EDGECAST_TOKEN")
-	platformsEnv = os.Getenv("EDGECAST_PLATFORMS")
+	// command-line flags, overriding the respective keys of the configuration file and environment
+	configFile         = flag.String("config.file", "", "Path to the YAML configuration file. Environment variables override individual keys.")
+	webConfigFile      = flag.String("web.config.file", "", "Path to the Prometheus web-config file enabling TLS and/or basic auth.")
+	metricsLegacyNames = flag.Bool("metrics.legacy-names", false, "Additionally expose all metrics under their names before the Prometheus naming conventions were adopted.")
+	webEnableLifecycle = flag.Bool("web.enable-lifecycle", false, "Enable reloading the configuration via HTTP POST requests to /-/reload.")
+	recordDir          = flag.String("record", "", "Directory to save every raw response of the Edgecast API to, per account, method, platform and timestamp.")
+	replayDir          = flag.String("replay", "", "Directory of responses saved by --record, served instead of querying the Edgecast API.")
+	webListenAddresses listFlag
 )
 
-func main() {
+func init() {
+	flag.Var(&webListenAddresses, "web.listen-address", "Address to serve the metrics on. Repeatable to listen on multiple addresses.")
+}
 
-	// check if account ID and token were properly specified using the environment variables
-	if len(accountID) == 0 || len(token) == 0 {
-		fmt.Println(errors.New("error: empty Account-ID or Token!\n-> Please specify using environment variables EDGECAST_ACCOUNT_ID and EDGECAST_TOKEN"))
-		os.Exit(1)
-	}
+// listFlag collects the values of a repeatable command-line flag
+type listFlag []string
 
-	// Check if we can get the platforms to monitor from the environment.
-	// If not, use the default (monitor all platforms).
-	var platforms map[int]string
-	if len(platformsEnv) == 0 {
-		platforms = Platforms
-	} else {
-		split := strings.Split(platformsEnv, ",")
-		platforms := make(map[int]string, len(split))
-		for _, s := range split {
-			i, err := strconv.Atoi(s)
-			if err != nil {
-				fmt.Println(fmt.Errorf("Invalid platform: %s", s))
-				os.Exit(1)
-			}
-			if val, ok := Platforms[i]; ok {
-				platforms[i] = val
-			} else {
-				fmt.Println(fmt.Errorf("Invalid platform: %s", s))
-				os.Exit(1)
-			}
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
 
-		}
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	flag.Parse()
+
+	// load the configuration from file and environment-variables, listing all problems at once
+	cfg, err := LoadConfig(*configFile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
 	// create new logger on Stderr
-	logger := log.NewLogfmtLogger(os.Stderr)
+	logger := newLogger(cfg.Log)
 
 	// Prometheus metrics settings for this service
-	fieldKeys := []string{"method", "error"} // label names
-	requestCount := kitprometheus.NewCounterFrom(prometheus.CounterOpts{
-		Namespace: "Edgecast",
-		Subsystem: "service_metrics",
-		Name:      "request_count",
-		Help:      "Number of requests received.",
+	fieldKeys := []string{"account", "method", "error"} // label names
+	var requestCount metrics.Counter = kitprometheus.NewCounterFrom(prometheus.CounterOpts{
+		Namespace: "edgecast",
+		Subsystem: "api",
+		Name:      "requests_total",
+		Help:      "Number of requests to the Edgecast API.",
 	}, fieldKeys)
-	requestLatency := kitprometheus.NewSummaryFrom(prometheus.SummaryOpts{
-		Namespace: "Edgecast",
-		Subsystem: "service_metrics",
-		Name:      "request_latency_distribution_seconds",
-		Help:      "Total duration of requests in seconds.",
+	var requestLatency metrics.Histogram = kitprometheus.NewSummaryFrom(prometheus.SummaryOpts{
+		Namespace: "edgecast",
+		Subsystem: "api",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of requests to the Edgecast API in seconds.",
 	}, fieldKeys)
-	requestGauge := kitprometheus.NewGaugeFrom(prometheus.GaugeOpts{
-		Namespace: "Edgecast",
-		Subsystem: "service_metrics",
-		Name:      "request_latency_seconds",
-		Help:      "Duration of request in seconds.",
+	var requestGauge metrics.Gauge = kitprometheus.NewGaugeFrom(prometheus.GaugeOpts{
+		Namespace: "edgecast",
+		Subsystem: "api",
+		Name:      "last_request_duration_seconds",
+		Help:      "Duration of the last request to the Edgecast API in seconds.",
 	}, fieldKeys)
+	if cfg.LegacyMetricNames {
+		// record every request under the legacy names as well
+		requestCount = multi.NewCounter(requestCount, kitprometheus.NewCounterFrom(prometheus.CounterOpts{
+			Namespace: "Edgecast",
+			Subsystem: "service_metrics",
+			Name:      "request_count",
+			Help:      "Number of requests received.",
+		}, fieldKeys))
+		requestLatency = multi.NewHistogram(requestLatency, kitprometheus.NewSummaryFrom(prometheus.SummaryOpts{
+			Namespace: "Edgecast",
+			Subsystem: "service_metrics",
+			Name:      "request_latency_distribution_seconds",
+			Help:      "Total duration of requests in seconds.",
+		}, fieldKeys))
+		requestGauge = multi.NewGauge(requestGauge, kitprometheus.NewGaugeFrom(prometheus.GaugeOpts{
+			Namespace: "Edgecast",
+			Subsystem: "service_metrics",
+			Name:      "request_latency_seconds",
+			Help:      "Duration of request in seconds.",
+		}, fieldKeys))
+	}
+	retryCount := kitprometheus.NewCounterFrom(prometheus.CounterOpts{
+		Namespace: "edgecast",
+		Subsystem: "api",
+		Name:      "retries_total",
+		Help:      "Number of retried requests to the Edgecast API.",
+	}, []string{"account", "method", "reason"})
+	limiterWait := kitprometheus.NewSummaryFrom(prometheus.SummaryOpts{
+		Namespace: "edgecast",
+		Subsystem: "api",
+		Name:      "limiter_wait_seconds",
+		Help:      "Time requests to the Edgecast API waited for a rate limiter in seconds.",
+	}, []string{"account", "method", "limiter"})
 
-	// create EdgecastClient that communicates with the Edgecast API
-	var svc EdgecastInterface = edgecast.NewEdgecastClient(accountID, token)
-	// attach logger to service
-	svc = loggingMiddleware{logger, svc}
-	// attach instrumenting middleware
-	svc = instrumentingMiddleware{requestCount, requestLatency, requestGauge, svc}
+	circuitState := kitprometheus.NewGaugeFrom(prometheus.GaugeOpts{
+		Namespace: "edgecast",
+		Subsystem: "circuit",
+		Name:      "state",
+		Help:      "State of the circuit breaker per method and platform (0 = closed, 1 = half-open, 2 = open).",
+	}, []string{"account", "method", "platform"})
 
-	// create the prometheus collector that uses the EdgecastClient and register it to prometheus
-	collector := NewEdgecastCollector(&svc, platforms)
-	prometheus.MustRegister(collector)
+	tokenLoaded := kitprometheus.NewGaugeFrom(prometheus.GaugeOpts{
+		Namespace: "edgecast",
+		Subsystem: "token_file",
+		Name:      "last_load_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful load of the account's token file.",
+	}, []string{"account"})
+
+	purgesSubmitted := kitprometheus.NewCounterFrom(prometheus.CounterOpts{
+		Namespace: "edgecast",
+		Subsystem: "purge",
+		Name:      "submitted_total",
+		Help:      "Number of purges submitted via the purge API per platform and result.",
+	}, []string{"account", "platform", "result"})
+
+	m := serviceMetrics{requestCount, requestLatency, requestGauge, retryCount, limiterWait, circuitState, tokenLoaded}
+
+	// ctx is cancelled on shutdown, stopping the pollers and all outstanding requests to the Edgecast API
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// build clients, pollers and collectors of all accounts, and rebuild them whenever the configuration is reloaded
+	exporters := newReloader(ctx, cfg, m, logger)
+	prometheus.MustRegister(exporters)
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go exporters.reloadOnSignal(ctx, hangups)
 
 	// connect handlers
 	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/probe", probeHandler{exporters.current})
+	http.HandleFunc("/healthz", healthzHandler)
+	http.Handle("/ready", readyHandler{exporters.current})
+	http.Handle("/api/v1/purge", purgeHandler{exporters.current, purgesSubmitted})
+	http.Handle("/", landingHandler{exporters.current})
+	if *webEnableLifecycle {
+		if cfg.Web.ConfigFile == "" {
+			_ = level.Warn(logger).Log("msg", "lifecycle endpoints are enabled without a web-config file, anyone can trigger a reload")
+		}
+		http.Handle("/-/reload", exporters)
+	}
+
+	// start service on the configured addresses, using TLS and basic auth as set in the web-config file
+	// - requests inherit ctx, so probes still running at the end of the grace period are cancelled
+	systemdSocket := false
+	server := &http.Server{BaseContext: func(net.Listener) context.Context { return ctx }}
+	served := make(chan error, 1)
+	go func() {
+		served <- web.ListenAndServe(server, &web.FlagConfig{
+			WebListenAddresses: &cfg.Web.ListenAddresses,
+			WebSystemdSocket:   &systemdSocket,
+			WebConfigFile:      &cfg.Web.ConfigFile,
+		}, toolkitLogger(logger))
+	}()
+
+	// serve until SIGTERM/SIGINT or a failure of the server, e.g. an address already in use
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-served:
+		_ = level.Error(logger).Log("msg", "serving failed", "err", err)
+		cancel()
+		exporters.stop()
+		os.Exit(1)
+	case sig := <-signals:
+		_ = level.Info(logger).Log("msg", "shutting down", "signal", sig, "grace_period", cfg.Web.ShutdownGracePeriod)
+	}
+	shutdown(server, cfg.Web.ShutdownGracePeriod, signals, cancel, exporters, logger)
+	_ = level.Info(logger).Log("msg", "shutdown complete")
+}
+
+// shutdown() stops accepting connections and waits up to gracePeriod for in-flight requests to finish,
+// then cancels all outstanding work and waits for the pollers of the current exporter to return
+// - a second signal or the end of the grace period cut off the remaining requests, which is not treated as a failure
+func shutdown(server *http.Server, gracePeriod time.Duration, signals <-chan os.Signal, cancel context.CancelFunc, exporters *reloader, logger log.Logger) {
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancelShutdown()
+	go func() {
+		select {
+		case <-signals:
+			cancelShutdown()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := server.Shutdown(ctx); err != nil {
+		_ = level.Warn(logger).Log("msg", "grace period exceeded, cancelling in-flight requests", "err", err)
+	}
+	cancel()
+	_ = server.Close()
+	exporters.stop()
+}
+
+// newLogger creates a logger on Stderr in the configured format that drops entries below the configured level
+// - entries without a level are treated as info
+func newLogger(cfg LogConfig) log.Logger {
+	var logger log.Logger
+	if cfg.Format == "json" {
+		logger = log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	} else {
+		logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	}
+
+	var allowed level.Option
+	switch cfg.Level {
+	case "debug":
+		allowed = level.AllowDebug()
+	case "warn":
+		allowed = level.AllowWarn()
+	case "error":
+		allowed = level.AllowError()
+	default:
+		allowed = level.AllowInfo()
+	}
+	return level.NewInjector(level.NewFilter(logger, allowed), level.InfoValue())
+}
 
-	// set up logger and start service on port 80
-	_ = logger.Log("msg", "HTTP", "addr", ":80")
-	_ = logger.Log("err", http.ListenAndServe(":80", nil))
+// toolkitLogger() adapts logger to the exporter-toolkit, which tags its messages with the levels of go-kit's successor log package
+// - the levels are translated, so the toolkit's messages are filtered like any other message
+func toolkitLogger(logger log.Logger) log.Logger {
+	levels := map[string]level.Value{
+		"debug": level.DebugValue(),
+		"info":  level.InfoValue(),
+		"warn":  level.WarnValue(),
+		"error": level.ErrorValue(),
+	}
+	return log.LoggerFunc(func(keyvals ...interface{}) error {
+		for i := 1; i < len(keyvals); i += 2 {
+			if v, ok := keyvals[i].(toolkitlevel.Value); ok {
+				keyvals[i] = levels[v.String()]
+			}
+		}
+		return logger.Log(keyvals...)
+	})
 }
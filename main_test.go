@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name        string
+		gracePeriod time.Duration
+		signal      bool // send a second signal while waiting
+		finished    bool // whether the in-flight request finishes instead of being cancelled
+	}{
+		{"request finishes within the grace period", 5 * time.Second, false, true},
+		{"grace period exceeded", 50 * time.Millisecond, false, false},
+		{"second signal", 5 * time.Second, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Secrets = []AccountConfig{{ID: "ABCD", Token: "secret", Name: "main"}}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			exporters := newReloader(ctx, &cfg, discardMetrics(), log.NewNopLogger())
+
+			// the handler takes 500ms unless its request is cancelled before
+			started, finished := make(chan struct{}), make(chan bool, 1)
+			server := &http.Server{
+				BaseContext: func(net.Listener) context.Context { return ctx },
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					close(started)
+					select {
+					case <-time.After(500 * time.Millisecond):
+						finished <- true
+					case <-r.Context().Done():
+						finished <- false
+					}
+				}),
+			}
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go func() { _ = server.Serve(listener) }()
+			go func() {
+				resp, err := http.Get("http://" + listener.Addr().String())
+				if err == nil {
+					resp.Body.Close()
+				}
+			}()
+			<-started
+
+			signals := make(chan os.Signal, 1)
+			if tt.signal {
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					signals <- syscall.SIGTERM
+				}()
+			}
+			begin := time.Now()
+			shutdown(server, tt.gracePeriod, signals, cancel, exporters, log.NewNopLogger())
+			elapsed := time.Since(begin)
+
+			if got := <-finished; got != tt.finished {
+				t.Errorf("request finished = %v, want %v", got, tt.finished)
+			}
+			if !tt.finished && elapsed > 400*time.Millisecond {
+				t.Errorf("shutdown() took %s, want it to cut the request short", elapsed)
+			}
+			if ctx.Err() == nil {
+				t.Error("shutdown() didn't cancel the outstanding work")
+			}
+			if _, err := http.Get("http://" + listener.Addr().String()); err == nil {
+				t.Error("server still accepts connections after shutdown()")
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Poller periodically fetches the selected metric types of every platform in the background and keeps the latest results,
+// so that Prometheus scrapes are served from memory instead of querying the Edgecast API directly
+type Poller struct {
+	ec       EdgecastInterface
+	metrics  metricSelection
+	interval time.Duration
+
+	results *snapshot // latest fetchResult per pollKey
+}
+
+// pollKey identifies a single metric type of a single platform inside the snapshot
+type pollKey struct {
+	platform int
+	metric   string
+}
+
+// NewPoller constructs a new Poller that refreshes the selected metric types of every platform every interval
+func NewPoller(client *EdgecastInterface, metrics metricSelection, interval time.Duration) *Poller {
+	return &Poller{
+		ec:       *client,
+		metrics:  metrics,
+		interval: interval,
+		results:  newSnapshot(),
+	}
+}
+
+// Run fetches the metrics once immediately and then on every tick of the poll interval until ctx is done
+func (p *Poller) Run(ctx context.Context) {
+	runEvery(ctx, p.interval, p.poll)
+}
+
+// poll() fetches the metrics and stores them in the snapshot
+// - failed fetches keep the previously fetched data (and its timestamp), so the snapshot age keeps growing
+func (p *Poller) poll(ctx context.Context) {
+	for _, r := range fetch(ctx, p.ec, p.metrics) {
+		r := r
+		p.results.update(pollKey{r.platform, r.metric}, func(prev interface{}, ok bool) interface{} {
+			if ok && r.err != nil {
+				prev := prev.(fetchResult)
+				prev.err, prev.duration, prev.fetched = r.err, r.duration, r.fetched
+				return prev
+			}
+			return r
+		})
+	}
+}
+
+// seed() fills the snapshot with results of a previous poller, e.g. after a reload
+// - only results of the metric types selected for the poller's platforms are taken over
+func (p *Poller) seed(results []fetchResult) {
+	for _, r := range results {
+		if contains(p.metrics[r.platform], r.metric) {
+			p.results.set(pollKey{r.platform, r.metric}, r)
+		}
+	}
+}
+
+// ready() returns whether at least one metric type of one platform was fetched successfully by the latest poll
+// - false until the first poll has finished and whenever all fetches of the latest poll failed
+// - true if no platform is selected, as there is nothing to fetch
+func (p *Poller) ready() bool {
+	if len(p.metrics) == 0 {
+		return true
+	}
+	for _, r := range p.snapshot() {
+		if r.err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot() returns the latest results of all platforms and metric types
+func (p *Poller) snapshot() []fetchResult {
+	values := p.results.values()
+	results := make([]fetchResult, 0, len(values))
+	for _, r := range values {
+		results = append(results, r.(fetchResult))
+	}
+	return results
+}
+
+// runEvery() calls poll once immediately and then on every tick of interval until ctx is done
+// - every call is cancelled once the next one is due, so they never pile up
+func runEvery(ctx context.Context, interval time.Duration, poll func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pollCtx, cancel := context.WithTimeout(ctx, interval)
+		poll(pollCtx)
+		cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshot holds the latest result per key of a poller, safe for concurrent use
+// - the pollers wrap it to convert the results to and from their own types
+type snapshot struct {
+	mtx     sync.RWMutex
+	results map[interface{}]interface{}
+}
+
+// newSnapshot creates an empty snapshot
+func newSnapshot() *snapshot {
+	return &snapshot{results: make(map[interface{}]interface{})}
+}
+
+// get() returns the latest result of key, ok is false if there is none
+func (s *snapshot) get(key interface{}) (result interface{}, ok bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	result, ok = s.results[key]
+	return result, ok
+}
+
+// set() replaces the result of key
+func (s *snapshot) set(key, result interface{}) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.results[key] = result
+}
+
+// update() replaces the result of key by the one merge returns for the previous result, ok is false if there was none
+// - merge is called with the snapshot locked, so concurrent updates of the same key aren't lost
+func (s *snapshot) update(key interface{}, merge func(prev interface{}, ok bool) interface{}) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	prev, ok := s.results[key]
+	s.results[key] = merge(prev, ok)
+}
+
+// values() returns the latest results of all keys in no particular order
+func (s *snapshot) values() []interface{} {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	values := make([]interface{}, 0, len(s.results))
+	for _, r := range s.results {
+		values = append(values, r)
+	}
+	return values
+}
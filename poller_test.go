@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/trivago/exporter-edgecast/edgecast"
+)
+
+func TestPollerKeepsDataOnFailure(t *testing.T) {
+	svc := &breakerService{fixtureService: fixtureService{t}}
+	var ec EdgecastInterface = svc
+	poller := NewPoller(&ec, metricSelection{3: {metricBandwidth}}, time.Minute)
+
+	poller.poll(context.Background())
+	first := poller.snapshot()
+	if len(first) != 1 || first[0].err != nil || first[0].timestamp.IsZero() {
+		t.Fatalf("snapshot after a successful poll = %+v, want a single successful result", first)
+	}
+
+	time.Sleep(time.Millisecond) // keep the times of the polls apart
+	svc.err = &edgecast.ServerError{StatusCode: http.StatusBadGateway}
+	poller.poll(context.Background())
+	second := poller.snapshot()
+	if len(second) != 1 {
+		t.Fatalf("snapshot after a failed poll holds %d results, want 1", len(second))
+	}
+	r := second[0]
+	if r.err != svc.err {
+		t.Errorf("error = %v, want %v", r.err, svc.err)
+	}
+	if r.data != first[0].data {
+		t.Errorf("data = %v, want the previously fetched %v", r.data, first[0].data)
+	}
+	if !r.timestamp.Equal(first[0].timestamp) {
+		t.Errorf("timestamp = %s, want the one of the previous success %s", r.timestamp, first[0].timestamp)
+	}
+	if !r.fetched.After(first[0].fetched) {
+		t.Errorf("time of the failed fetch %s isn't after the previous one %s", r.fetched, first[0].fetched)
+	}
+	if poller.ready() {
+		t.Error("ready() = true after all fetches of the latest poll failed")
+	}
+}
+
+func TestPollingCollector(t *testing.T) {
+	svc := &breakerService{fixtureService: fixtureService{t}}
+	var ec EdgecastInterface = svc
+	poller := NewPoller(&ec, metricSelection{3: {metricBandwidth}}, time.Minute)
+	col := NewPollingEdgecastCollector("main", poller, collectorOptions{})
+
+	// nothing is exposed but edgecast_up before the first poll
+	if n := testutil.CollectAndCount(col); n != 1 {
+		t.Errorf("collected %d series before the first poll, want only edgecast_up", n)
+	}
+	if _, ok := gatherValue(t, col, "edgecast_snapshot_age_seconds"); ok {
+		t.Error("exposed edgecast_snapshot_age_seconds before the first poll")
+	}
+
+	poller.poll(context.Background())
+	svc.calls = 0
+	want := `
+# HELP edgecast_bandwidth_bits_per_second Current bandwidth usage per platform in bits per second.
+# TYPE edgecast_bandwidth_bits_per_second gauge
+edgecast_bandwidth_bits_per_second{account="main",platform="http_large"} 42.42
+# HELP edgecast_up Whether the last fetch from the Edgecast API succeeded for at least one platform and metric type.
+# TYPE edgecast_up gauge
+edgecast_up{account="main"} 1
+`
+	for i := 0; i < 3; i++ {
+		if err := testutil.CollectAndCompare(col, strings.NewReader(want), "edgecast_bandwidth_bits_per_second", "edgecast_up"); err != nil {
+			t.Error(err)
+		}
+	}
+	if svc.calls != 0 {
+		t.Errorf("scrapes called the API %d times, want them served from the snapshot", svc.calls)
+	}
+	if age, ok := gatherValue(t, col, "edgecast_snapshot_age_seconds"); !ok || age < 0 || age > 1 {
+		t.Errorf("edgecast_snapshot_age_seconds = %v right after a successful poll, want about 0", age)
+	}
+
+	// the age keeps growing from the last success while polls fail, and the data stays exposed
+	svc.err = &edgecast.ServerError{StatusCode: http.StatusBadGateway}
+	time.Sleep(50 * time.Millisecond)
+	poller.poll(context.Background())
+	if age, ok := gatherValue(t, col, "edgecast_snapshot_age_seconds"); !ok || age < 0.05 {
+		t.Errorf("edgecast_snapshot_age_seconds = %v after a failed poll, want at least the 0.05s since the last success", age)
+	}
+	if err := testutil.CollectAndCompare(col, strings.NewReader(strings.Replace(want, "} 1\n", "} 0\n", 1)), "edgecast_bandwidth_bits_per_second", "edgecast_up"); err != nil {
+		t.Error(err)
+	}
+}
+
+// gatherValue returns the value of the only series of the named metric collected by col, ok is false if there is none
+func gatherValue(t *testing.T, col prometheus.Collector, name string) (value float64, ok bool) {
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(col); err != nil {
+		t.Fatal(err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() == name && len(f.GetMetric()) == 1 {
+			return f.GetMetric()[0].GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/*
+ * probeHandler serves the metrics of a single target in the style of the blackbox_exporter,
+ * so Prometheus can use relabeling to drive which accounts and platforms are scraped.
+ * The target is given by the following query parameters:
+ * - account:	name of the account, whose credentials are looked up in the secrets (or accounts) of the configuration
+ * - platform:	comma-separated platform IDs or names (or auto), defaults to the platforms configured for that account
+ * - metrics:	comma-separated metric types fetched for every platform, defaults to the metric types configured per platform for that account
+ */
+type probeHandler struct {
+	current func() *exporter // returns the exporter of the current configuration
+}
+
+func (h probeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e := h.current()
+	query := r.URL.Query()
+
+	name := query.Get("account")
+	if name == "" {
+		http.Error(w, "account parameter is missing", http.StatusBadRequest)
+		return
+	}
+	account, ok := e.cfg.target(name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown account %q", name), http.StatusBadRequest)
+		return
+	}
+
+	platforms, auto := e.cfg.platforms(account)
+	if param := query.Get("platform"); param != "" {
+		selected := parsePlatforms(param)
+		if errs := validatePlatforms("platform", selected); len(errs) > 0 {
+			http.Error(w, strings.Join(errs, "\n"), http.StatusBadRequest)
+			return
+		}
+		platforms, auto = Platforms, selected.auto()
+		if !auto {
+			platforms = make(map[int]string, len(selected))
+			for _, p := range selected.ids() {
+				platforms[p] = Platforms[p]
+			}
+		}
+	}
+
+	metrics := e.cfg.metrics(account, platforms)
+	if param := query.Get("metrics"); param != "" {
+		selected := strings.Split(param, ",")
+		for _, m := range selected {
+			if !contains(metricTypes, m) {
+				http.Error(w, fmt.Sprintf("unknown metric type %q", m), http.StatusBadRequest)
+				return
+			}
+		}
+		metrics = selectMetrics(platforms, selected)
+	}
+
+	// build a fresh registry with a collector querying the API directly for just this target
+	// - all API calls are cancelled together with the scrape
+	ctx, cancel := scrapeContext(r)
+	defer cancel()
+	svc := e.newService(account)
+	if auto {
+		metrics = metrics.restrict(e.platformCaches[account.label()].discover(ctx, svc, metrics.platforms()))
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewEdgecastCollector(ctx, name, &svc, metrics, e.cfg.collectorOptions()))
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestProbeHandler(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Client.ReplayDir = "testing/recordings"
+	cfg.Client.Retries = 1
+	e := newTestExporter(t, &cfg)
+	h := probeHandler{func() *exporter { return e }}
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		want   []string // lines of the response
+		unwant []string // substrings that must not be part of the response
+	}{
+		{"missing account", "platform=3", http.StatusBadRequest, nil, nil},
+		{"unknown account", "account=other", http.StatusBadRequest, nil, nil},
+		{"unknown platform", "account=main&platform=http_tiny", http.StatusBadRequest, nil, nil},
+		{"auto with a platform", "account=main&platform=auto,3", http.StatusBadRequest, nil, nil},
+		{"unknown metric type", "account=main&platform=3&metrics=bandwidth,latency", http.StatusBadRequest, nil, nil},
+		{"single platform and metric type", "account=main&platform=http_large&metrics=bandwidth", http.StatusOK, []string{
+			`edgecast_bandwidth_bits_per_second{account="main",platform="http_large"} 42.42`,
+			`edgecast_scrape_success{account="main",metric="bandwidth",platform="http_large"} 1`,
+			`edgecast_up{account="main"} 1`,
+		}, []string{"edgecast_connections", "http_small", "go_goroutines", "edgecast_requests_total"}},
+		{"another platform", "account=main&platform=8&metrics=bandwidth", http.StatusOK, []string{
+			`edgecast_scrape_success{account="main",metric="bandwidth",platform="http_small"} 0`,
+			`edgecast_up{account="main"} 0`,
+		}, []string{"http_large"}},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/probe?"+tt.query, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, rec.Code, tt.status, rec.Body)
+			continue
+		}
+		lines := strings.Split(rec.Body.String(), "\n")
+		for _, want := range tt.want {
+			if !contains(lines, want) {
+				t.Errorf("%s: response lacks %s:\n%s", tt.name, want, rec.Body)
+			}
+		}
+		for _, unwant := range tt.unwant {
+			if strings.Contains(rec.Body.String(), unwant) {
+				t.Errorf("%s: response contains %s, although every probe has its own registry:\n%s", tt.name, unwant, rec.Body)
+			}
+		}
+	}
+}
+
+func TestProbeDiscoveryCache(t *testing.T) {
+	// the account is only subscribed to http_large
+	var calls int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if !strings.HasSuffix(r.URL.Path, "/media/3/bandwidth") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"Result": 1.5}`))
+	}))
+	defer api.Close()
+
+	cfg := DefaultConfig()
+	cfg.Client.BaseURL = api.URL
+	cfg.Client.Retries = 1
+	e := newTestExporter(t, &cfg)
+	h := probeHandler{func() *exporter { return e }}
+
+	// only the first probe discovers the platforms, every probe fetches the bandwidth of http_large
+	for i, want := range []int32{int32(len(Platforms)) + 1, 1, 1} {
+		atomic.StoreInt32(&calls, 0)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/probe?account=main&platform=auto&metrics=bandwidth", nil))
+		if line := `edgecast_bandwidth_bits_per_second{account="main",platform="http_large"} 1.5`; !contains(strings.Split(rec.Body.String(), "\n"), line) {
+			t.Errorf("probe %d: response lacks %s:\n%s", i, line, rec.Body)
+		}
+		if got := atomic.LoadInt32(&calls); got != want {
+			t.Errorf("probe %d: called the API %d times, want %d", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-kit/kit/metrics"
+)
+
+// results of submitted purges, exposed as result label
+const (
+	purgeSuccess = "success"
+	purgeError   = "error"
+)
+
+// maxPurgeRequestSize bounds the body of a request to the purge endpoint
+const maxPurgeRequestSize = 64 << 10
+
+// purgeTokenHeader carries the token authorizing a purge, next to the basic auth of the web-config file in the Authorization header
+const purgeTokenHeader = "X-Purge-Token"
+
+/*
+ * purgeHandler submits a purge to the Edgecast API on behalf of a configured account, if the purge API is enabled.
+ * Requests are POSTed as JSON object with the following keys, authorized by the configured token (see authorize()):
+ * - account:	name of the account, whose credentials are looked up in the secrets (or accounts) of the configuration
+ * - platform:	platform ID or name (media type) of the purged content
+ * - path:	full URL of the purged content using a CNAME or the CDN URL, may end with a wildcard
+ * The purge runs through the same middlewares as every other request of the account. Every authorized
+ * submission and every rejected token is recorded in the audit log.
+ */
+type purgeHandler struct {
+	current   func() *exporter // returns the exporter of the current configuration
+	submitted metrics.Counter  // submitted purges per account, platform and result
+}
+
+// purgeSubmission is the body of a request to the purge endpoint
+type purgeSubmission struct {
+	Account  string        `json:"account"`
+	Platform platformParam `json:"platform"`
+	Path     string        `json:"path"`
+}
+
+// platformParam holds a platform given by ID or name, as JSON number or string
+type platformParam string
+
+// UnmarshalJSON decodes a platform given as number (e.g. 3) or string (e.g. "3" or "http_large")
+func (p *platformParam) UnmarshalJSON(data []byte) error {
+	var id int
+	if err := json.Unmarshal(data, &id); err == nil {
+		*p = platformParam(fmt.Sprint(id))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("platform must be an ID or name")
+	}
+	*p = platformParam(s)
+	return nil
+}
+
+func (h purgeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e := h.current()
+	cfg := e.cfg.PurgeAPI
+	if !cfg.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "purges must be submitted via POST", http.StatusMethodNotAllowed)
+		return
+	}
+	audit := log.With(auditLog{cfg.AuditLogFile}, "ts", log.DefaultTimestampUTC, "remote_addr", r.RemoteAddr)
+
+	if err := authorize(r, cfg); err != nil {
+		_ = audit.Log("msg", "purge rejected", "result", "unauthorized", "err", err)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="purge"`)
+		http.Error(w, "invalid or missing purge token", http.StatusUnauthorized)
+		return
+	}
+
+	var submission purgeSubmission
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxPurgeRequestSize)).Decode(&submission); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	account, ok := e.cfg.target(submission.Account)
+	if submission.Account == "" || !ok {
+		http.Error(w, fmt.Sprintf("unknown account %q", submission.Account), http.StatusBadRequest)
+		return
+	}
+	platform, ok := platformID(string(submission.Platform))
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown platform %q", submission.Platform), http.StatusBadRequest)
+		return
+	}
+	if !strings.HasPrefix(submission.Path, "http://") && !strings.HasPrefix(submission.Path, "https://") {
+		http.Error(w, fmt.Sprintf("path %q must be a full http(s) URL", submission.Path), http.StatusBadRequest)
+		return
+	}
+
+	// submit the purge using the account's limiters, circuit breakers, retries, logging and instrumentation
+	svc := e.newService(account)
+	begin := time.Now()
+	data, err := svc.Purge(r.Context(), platform, submission.Path)
+
+	result := purgeSuccess
+	var id string
+	if err != nil {
+		result = purgeError
+	} else {
+		id = data.ID
+	}
+	h.submitted.With("account", submission.Account, "platform", Platforms[platform], "result", result).Add(1)
+	if auditErr := audit.Log(
+		"msg", "purge submitted",
+		"account", submission.Account,
+		"platform", Platforms[platform],
+		"path", submission.Path,
+		"result", result,
+		"id", id,
+		"err", err,
+		"took", time.Since(begin),
+	); auditErr != nil {
+		_ = level.Error(e.logger).Log("msg", "writing audit log failed", "account", submission.Account, "path", submission.Path, "purge_id", id, "err", auditErr)
+	}
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("submitting purge failed: %v", err), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"id":       id,
+		"account":  submission.Account,
+		"platform": Platforms[platform],
+		"path":     submission.Path,
+	})
+}
+
+// authorize() checks the token of the request against the configured one
+// - the token is taken from the X-Purge-Token header, so the endpoint stays reachable if the web-config file requires basic auth
+// - without that header, a bearer token in the Authorization header is accepted
+func authorize(r *http.Request, cfg PurgeAPIConfig) error {
+	want, err := cfg.token()
+	if err != nil {
+		return err
+	}
+	got := r.Header.Get(purgeTokenHeader)
+	if got == "" {
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			return fmt.Errorf("neither %s header nor bearer token given", purgeTokenHeader)
+		}
+		got = strings.TrimPrefix(header, "Bearer ")
+	}
+	if want == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		return fmt.Errorf("bearer token mismatch")
+	}
+	return nil
+}
+
+// auditLog writes every entry as JSON line to stderr or appends it to the given file
+// - the file is opened for every entry, so it can be rotated without notifying the exporter
+// - entries are never filtered by the log level
+type auditLog struct {
+	path string
+}
+
+// Log writes a single entry
+// - implements function of interface log.Logger
+func (a auditLog) Log(keyvals ...interface{}) error {
+	if a.path == "" {
+		return log.NewJSONLogger(os.Stderr).Log(keyvals...)
+	}
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if err := log.NewJSONLogger(f).Log(keyvals...); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
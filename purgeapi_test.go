@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/exporter-toolkit/web"
+)
+
+func TestPurgeHandler(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/v2/mcc/customers/ABCD/edge/purge" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"Id": "5c4e6b4f1e8a"}`))
+	}))
+	defer api.Close()
+
+	cfg := DefaultConfig()
+	cfg.Purges.BaseURL = api.URL + "/v2/mcc"
+	cfg.PurgeAPI = PurgeAPIConfig{Enabled: true, BearerToken: "letmein", AuditLogFile: filepath.Join(t.TempDir(), "audit.log")}
+	e := newTestExporter(t, &cfg)
+	submitted := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "edgecast_purge_submitted_total"}, []string{"account", "platform", "result"})
+	h := purgeHandler{func() *exporter { return e }, kitprometheus.NewCounter(submitted)}
+
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{"missing token", "", `{"account": "main", "platform": "http_small", "path": "http://cdn.example.com/*"}`, http.StatusUnauthorized},
+		{"wrong token", "letmeout", `{"account": "main", "platform": "http_small", "path": "http://cdn.example.com/*"}`, http.StatusUnauthorized},
+		{"unknown account", "letmein", `{"account": "other", "platform": 8, "path": "http://cdn.example.com/*"}`, http.StatusBadRequest},
+		{"unknown platform", "letmein", `{"account": "main", "platform": "http_tiny", "path": "http://cdn.example.com/*"}`, http.StatusBadRequest},
+		{"relative path", "letmein", `{"account": "main", "platform": 8, "path": "/images/*"}`, http.StatusBadRequest},
+		{"by name", "letmein", `{"account": "main", "platform": "http_small", "path": "http://cdn.example.com/*"}`, http.StatusOK},
+		{"by ID", "letmein", `{"account": "main", "platform": 8, "path": "http://cdn.example.com/images/*"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/purge", strings.NewReader(tt.body))
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, rec.Code, tt.status, rec.Body)
+		}
+	}
+
+	if got := testutil.ToFloat64(submitted.WithLabelValues("main", "http_small", purgeSuccess)); got != 2 {
+		t.Errorf("counted %v submitted purges, want 2", got)
+	}
+	audit, err := ioutil.ReadFile(cfg.PurgeAPI.AuditLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(audit)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("audit log holds %d entries, want 4 (2 rejected, 2 submitted):\n%s", len(lines), audit)
+	}
+	if want := `"id":"5c4e6b4f1e8a"`; !strings.Contains(lines[3], want) || !strings.Contains(lines[3], `"path":"http://cdn.example.com/images/*"`) {
+		t.Errorf("last audit entry %s lacks the purge ID and path", lines[3])
+	}
+}
+
+// TestPurgeHandlerBasicAuth serves the purge endpoint behind the basic auth of a web-config file,
+// which occupies the Authorization header, so the purge token has to be sent in its own header
+func TestPurgeHandlerBasicAuth(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Id": "5c4e6b4f1e8a"}`))
+	}))
+	defer api.Close()
+
+	webConfig := filepath.Join(t.TempDir(), "web-config.yml")
+	users := "basic_auth_users:\n  prometheus: $2a$04$5L0vsXV1SP2W5UgkkHA8cOg8hbA50c/Ss9MLS6DX5477ua0PdUFxu\n" // password: scrape
+	if err := ioutil.WriteFile(webConfig, []byte(users), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Purges.BaseURL = api.URL + "/v2/mcc"
+	cfg.PurgeAPI = PurgeAPIConfig{Enabled: true, BearerToken: "letmein", AuditLogFile: filepath.Join(t.TempDir(), "audit.log")}
+	e := newTestExporter(t, &cfg)
+	submitted := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "edgecast_purge_submitted_total"}, []string{"account", "platform", "result"})
+
+	// pick a free port, web.ListenAndServe only takes addresses
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	server := &http.Server{Handler: purgeHandler{func() *exporter { return e }, kitprometheus.NewCounter(submitted)}}
+	defer server.Close()
+	addresses, systemdSocket := []string{addr}, false
+	go func() {
+		_ = web.ListenAndServe(server, &web.FlagConfig{WebListenAddresses: &addresses, WebSystemdSocket: &systemdSocket, WebConfigFile: &webConfig}, log.NewNopLogger())
+	}()
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		header   string
+		token    string
+		status   int
+	}{
+		{"purge token without basic auth", "", "", purgeTokenHeader, "letmein", http.StatusUnauthorized},
+		{"wrong password", "prometheus", "guess", purgeTokenHeader, "letmein", http.StatusUnauthorized},
+		{"basic auth without purge token", "prometheus", "scrape", "", "", http.StatusUnauthorized},
+		{"wrong purge token", "prometheus", "scrape", purgeTokenHeader, "letmeout", http.StatusUnauthorized},
+		{"basic auth and purge token", "prometheus", "scrape", purgeTokenHeader, "letmein", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s/api/v1/purge", addr), strings.NewReader(`{"account": "main", "platform": "http_small", "path": "http://cdn.example.com/*"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.user != "" {
+			req.SetBasicAuth(tt.user, tt.password)
+		}
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.token)
+		}
+		resp, err := doWhenListening(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+	if got := testutil.ToFloat64(submitted.WithLabelValues("main", "http_small", purgeSuccess)); got != 1 {
+		t.Errorf("counted %v submitted purges, want 1", got)
+	}
+}
+
+// doWhenListening sends the request, retrying for up to a second while the server isn't listening yet
+func doWhenListening(req *http.Request) (*http.Response, error) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil || time.Now().After(deadline) {
+			return resp, err
+		}
+		time.Sleep(10 * time.Millisecond)
+		if req.GetBody != nil {
+			req.Body, _ = req.GetBody()
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/trivago/exporter-edgecast/edgecast"
+)
+
+// states of purge requests, exposed as state label
+const (
+	purgePending   = "pending"
+	purgeCompleted = "completed"
+)
+
+var (
+	// purgeStates lists the states of purge requests in the order they are exposed
+	purgeStates = []string{purgePending, purgeCompleted}
+
+	// Prepared Description of all metrics of the purge requests
+	purgeRequests = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "purge", "requests"), "Purge requests submitted within the lookback window per state.", []string{"account", "state"}, nil,
+	)
+	purgeOldestPendingAge = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "purge", "oldest_pending_age_seconds"), "Time since the oldest pending purge request was submitted, 0 if none is pending.", []string{"account"}, nil,
+	)
+	purgeScrapeSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "purge", "scrape_success"), "Whether the last fetch of the purge requests from the Edgecast API succeeded.", []string{"account"}, nil,
+	)
+)
+
+// purgeResult holds the outcome of fetching the purge requests of an account
+type purgeResult struct {
+	data      *edgecast.PurgeRequestData
+	err       error
+	fetched   time.Time // time of the last fetch, successful or not
+	timestamp time.Time // time of the last successful fetch
+}
+
+// purgeKey is the key of the only result in the snapshot of a PurgePoller
+type purgeKey struct{}
+
+/*
+ * PurgePoller periodically fetches the purge requests of an account in the background, on its own schedule.
+ * Only purge requests submitted within the lookback window are fetched, so the effort per poll stays bounded.
+ */
+type PurgePoller struct {
+	ec       EdgecastInterface
+	interval time.Duration
+	lookback time.Duration
+
+	results *snapshot // latest purgeResult, stored as the only one
+}
+
+// NewPurgePoller constructs a new PurgePoller that fetches the purge requests of the account of the given client
+func NewPurgePoller(client *EdgecastInterface, cfg PurgesConfig) *PurgePoller {
+	return &PurgePoller{ec: *client, interval: cfg.PollInterval, lookback: cfg.Lookback, results: newSnapshot()}
+}
+
+// Run fetches the purge requests once immediately and then on every tick of the poll interval until ctx is done
+func (p *PurgePoller) Run(ctx context.Context) {
+	runEvery(ctx, p.interval, p.poll)
+}
+
+// poll() fetches the purge requests and stores them in the snapshot
+// - a failed fetch keeps the previously fetched purge requests
+func (p *PurgePoller) poll(ctx context.Context) {
+	data, err := p.ec.PurgeRequests(ctx, time.Now().Add(-p.lookback))
+	fetched := time.Now()
+
+	p.results.update(purgeKey{}, func(prev interface{}, ok bool) interface{} {
+		var r purgeResult
+		if ok {
+			r = prev.(purgeResult)
+		}
+		r.err, r.fetched = err, fetched
+		if err == nil {
+			r.data, r.timestamp = data, fetched
+		}
+		return r
+	})
+}
+
+// seed() takes over the result of a previous purge poller, e.g. after a reload
+func (p *PurgePoller) seed(result purgeResult) {
+	p.results.set(purgeKey{}, result)
+}
+
+// snapshot() returns the latest result, the zero result before the first poll
+func (p *PurgePoller) snapshot() purgeResult {
+	if r, ok := p.results.get(purgeKey{}); ok {
+		return r.(purgeResult)
+	}
+	return purgeResult{}
+}
+
+// PurgeCollector serves the latest snapshot of a PurgePoller of an account
+type PurgeCollector struct {
+	account string // value of the account label on every exposed series
+	poller  *PurgePoller
+}
+
+// NewPurgeCollector constructs a new PurgeCollector for an account serving the snapshot of the given poller
+func NewPurgeCollector(account string, poller *PurgePoller) *PurgeCollector {
+	return &PurgeCollector{account: account, poller: poller}
+}
+
+// Describe describes all exported metrics
+// - implements function of interface prometheus.Collector
+func (col PurgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- purgeRequests
+	ch <- purgeOldestPendingAge
+	ch <- purgeScrapeSuccess
+}
+
+// Collect exposes the poller's latest snapshot
+// - the age of the oldest pending purge keeps growing between polls
+// - implements function of interface prometheus.Collector
+func (col PurgeCollector) Collect(ch chan<- prometheus.Metric) {
+	r := col.poller.snapshot()
+	if r.fetched.IsZero() { // not fetched yet, nothing to expose
+		return
+	}
+	successVal := 0.0
+	if r.err == nil {
+		successVal = 1
+	}
+	ch <- prometheus.MustNewConstMetric(purgeScrapeSuccess, prometheus.GaugeValue, successVal, col.account)
+	if r.data == nil { // never fetched successfully
+		return
+	}
+
+	counts := make(map[string]float64, len(purgeStates))
+	var oldest time.Time
+	for _, purge := range *r.data {
+		if !purge.Pending() {
+			counts[purgeCompleted]++
+			continue
+		}
+		counts[purgePending]++
+		if submitted, err := purge.Submitted(); err == nil && (oldest.IsZero() || submitted.Before(oldest)) {
+			oldest = submitted
+		}
+	}
+	for _, state := range purgeStates {
+		ch <- prometheus.MustNewConstMetric(purgeRequests, prometheus.GaugeValue, counts[state], col.account, state)
+	}
+	age := 0.0
+	if !oldest.IsZero() {
+		age = time.Since(oldest).Seconds()
+	}
+	ch <- prometheus.MustNewConstMetric(purgeOldestPendingAge, prometheus.GaugeValue, age, col.account)
+}
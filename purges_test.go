@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPurgeCollector(t *testing.T) {
+	var svc EdgecastInterface = fixtureService{t}
+	poller := NewPurgePoller(&svc, DefaultConfig().Purges)
+	col := NewPurgeCollector("main", poller)
+
+	if n := testutil.CollectAndCount(col); n != 0 {
+		t.Errorf("collected %d series before the first poll, want none", n)
+	}
+
+	poller.poll(context.Background())
+	want := `
+# HELP edgecast_purge_requests Purge requests submitted within the lookback window per state.
+# TYPE edgecast_purge_requests gauge
+edgecast_purge_requests{account="main",state="completed"} 1
+edgecast_purge_requests{account="main",state="pending"} 2
+`
+	if err := testutil.CollectAndCompare(col, strings.NewReader(want), "edgecast_purge_requests"); err != nil {
+		t.Error(err)
+	}
+
+	// the oldest pending purge was submitted at 2019-06-01T10:05:00Z
+	minAge := time.Since(time.Date(2019, 6, 1, 10, 5, 0, 0, time.UTC)).Seconds()
+	if age := testutil.ToFloat64(oldestPendingAge{col}); age < minAge || age > minAge+60 {
+		t.Errorf("edgecast_purge_oldest_pending_age_seconds = %g, want about %g", age, minAge)
+	}
+}
+
+// oldestPendingAge collects only edgecast_purge_oldest_pending_age_seconds of the wrapped collector
+type oldestPendingAge struct {
+	*PurgeCollector
+}
+
+func (c oldestPendingAge) Collect(ch chan<- prometheus.Metric) {
+	all := make(chan prometheus.Metric)
+	go func() {
+		c.PurgeCollector.Collect(all)
+		close(all)
+	}()
+	for m := range all {
+		if m.Desc() == purgeOldestPendingAge {
+			ch <- m
+		}
+	}
+}
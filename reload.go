@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*
+ * reloader holds the exporter built from the current configuration and replaces it on reload:
+ * - the configuration is re-read from file, environment and flags, and the current exporter is kept if it is invalid
+ * - a valid configuration is turned into a new exporter, which atomically takes over all handlers and collectors
+ * Reloads are triggered by SIGHUP and by POST requests to /-/reload.
+ * Settings of the HTTP server and the logger, and the names of the service metrics are only applied on restart.
+ */
+type reloader struct {
+	ctx     context.Context // parent of all exporters, cancelled on shutdown
+	metrics serviceMetrics
+	logger  log.Logger
+
+	lastReloadSuccessful prometheus.Gauge
+	lastReloadSuccess    prometheus.Gauge
+
+	reloadMtx sync.Mutex // serializes reloads
+	mtx       sync.RWMutex
+	exporter  *exporter
+}
+
+// newReloader creates a reloader serving an exporter built from the given initial configuration
+func newReloader(ctx context.Context, cfg *Config, m serviceMetrics, logger log.Logger) *reloader {
+	r := &reloader{
+		ctx:     ctx,
+		metrics: m,
+		logger:  logger,
+		lastReloadSuccessful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "edgecast",
+			Subsystem: "config",
+			Name:      "last_reload_successful",
+			Help:      "Whether the last configuration reload attempt was successful.",
+		}),
+		lastReloadSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "edgecast",
+			Subsystem: "config",
+			Name:      "last_reload_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful configuration reload.",
+		}),
+		exporter: newExporter(ctx, cfg, m, logger, nil),
+	}
+	r.lastReloadSuccessful.Set(1)
+	r.lastReloadSuccess.SetToCurrentTime()
+	return r
+}
+
+// current returns the exporter of the current configuration
+func (r *reloader) current() *exporter {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.exporter
+}
+
+// reload re-reads the configuration and replaces the current exporter
+// - the current exporter is kept if the configuration is invalid
+func (r *reloader) reload() error {
+	r.reloadMtx.Lock()
+	defer r.reloadMtx.Unlock()
+
+	cfg, err := LoadConfig(*configFile)
+	if err != nil {
+		r.lastReloadSuccessful.Set(0)
+		_ = level.Error(r.logger).Log("msg", "reloading configuration failed, keeping the current one", "err", err)
+		return err
+	}
+
+	prev := r.current()
+	if !reflect.DeepEqual(cfg.Web, prev.cfg.Web) || cfg.Log != prev.cfg.Log {
+		_ = level.Warn(r.logger).Log("msg", "changed web and log settings only take effect on restart")
+	}
+	if cfg.LegacyMetricNames != prev.cfg.LegacyMetricNames {
+		_ = level.Warn(r.logger).Log("msg", "changed legacy_metric_names only applies to the service metrics on restart")
+	}
+
+	next := newExporter(r.ctx, cfg, r.metrics, r.logger, prev)
+	r.mtx.Lock()
+	r.exporter = next
+	r.mtx.Unlock()
+	prev.stop()
+
+	r.lastReloadSuccessful.Set(1)
+	r.lastReloadSuccess.SetToCurrentTime()
+	_ = level.Info(r.logger).Log("msg", "reloaded configuration", "accounts", len(cfg.Accounts))
+	return nil
+}
+
+// stop stops the current exporter for good, e.g. on shutdown
+func (r *reloader) stop() {
+	r.reloadMtx.Lock()
+	defer r.reloadMtx.Unlock()
+	r.current().stop()
+}
+
+// ServeHTTP reloads the configuration on POST requests to /-/reload
+// - answers 500 with the validation errors if the configuration is invalid
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.reload(); err != nil {
+		http.Error(w, fmt.Sprintf("failed to reload configuration: %v", err), http.StatusInternalServerError)
+		return
+	}
+	_, _ = fmt.Fprintln(w, "OK")
+}
+
+// Describe describes the metrics of the current exporter's collectors and the reload metrics
+// - implements function of interface prometheus.Collector
+func (r *reloader) Describe(ch chan<- *prometheus.Desc) {
+	r.current().Describe(ch)
+	r.lastReloadSuccessful.Describe(ch)
+	r.lastReloadSuccess.Describe(ch)
+}
+
+// Collect collects the metrics of the current exporter's collectors and the reload metrics
+// - implements function of interface prometheus.Collector
+func (r *reloader) Collect(ch chan<- prometheus.Metric) {
+	r.current().Collect(ch)
+	r.lastReloadSuccessful.Collect(ch)
+	r.lastReloadSuccess.Collect(ch)
+}
+
+// reloadOnSignal reloads the configuration whenever a signal is received, until ctx is done
+func (r *reloader) reloadOnSignal(ctx context.Context, signals <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			_ = r.reload()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "edgecast.yml")
+	writeConfig := func(content string) {
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prevFile := *configFile
+	*configFile = file
+	defer func() { *configFile = prevFile }()
+
+	writeConfig("secrets:\n  - id: ABCD\n    token: secret\n    name: main\n")
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newReloader(context.Background(), cfg, discardMetrics(), log.NewNopLogger())
+	defer r.stop()
+	if got := testutil.ToFloat64(r.lastReloadSuccessful); got != 1 {
+		t.Errorf("edgecast_config_last_reload_successful = %v after start, want 1", got)
+	}
+	loaded := testutil.ToFloat64(r.lastReloadSuccess)
+	first := r.current()
+	time.Sleep(10 * time.Millisecond) // keep the timestamps of the reloads apart
+
+	reload := func(method string) int {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, "/-/reload", nil))
+		return rec.Code
+	}
+
+	// only POST triggers a reload
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		if code := reload(method); code != http.StatusMethodNotAllowed {
+			t.Errorf("%s /-/reload: status = %d, want %d", method, code, http.StatusMethodNotAllowed)
+		}
+	}
+	if r.current() != first {
+		t.Error("a request other than POST replaced the exporter")
+	}
+
+	// an invalid configuration keeps the current exporter
+	writeConfig("secrets:\n  - id: ABCD\n    tokn: secret\n    name: main\n")
+	if code := reload(http.MethodPost); code != http.StatusInternalServerError {
+		t.Errorf("reload of an invalid configuration: status = %d, want %d", code, http.StatusInternalServerError)
+	}
+	if r.current() != first {
+		t.Error("reload of an invalid configuration replaced the exporter")
+	}
+	if got := testutil.ToFloat64(r.lastReloadSuccessful); got != 0 {
+		t.Errorf("edgecast_config_last_reload_successful = %v after a failed reload, want 0", got)
+	}
+	if got := testutil.ToFloat64(r.lastReloadSuccess); got != loaded {
+		t.Errorf("edgecast_config_last_reload_success_timestamp_seconds = %v after a failed reload, want it kept at %v", got, loaded)
+	}
+
+	// a valid configuration replaces it
+	writeConfig("secrets:\n  - id: ABCD\n    token: secret\n    name: other\n")
+	if code := reload(http.MethodPost); code != http.StatusOK {
+		t.Errorf("reload of a valid configuration: status = %d, want %d", code, http.StatusOK)
+	}
+	if e := r.current(); e == first || e.cfg.Secrets[0].Name != "other" {
+		t.Error("reload of a valid configuration didn't replace the exporter")
+	}
+	if got := testutil.ToFloat64(r.lastReloadSuccessful); got != 1 {
+		t.Errorf("edgecast_config_last_reload_successful = %v after a successful reload, want 1", got)
+	}
+	if got := testutil.ToFloat64(r.lastReloadSuccess); got <= loaded {
+		t.Errorf("edgecast_config_last_reload_success_timestamp_seconds = %v after a successful reload, want it after %v", got, loaded)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestReplay scrapes the responses recorded in testing/recordings through the middlewares of an account
+// - http_small only has a recorded server error
+func TestReplay(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Client.ReplayDir = "testing/recordings"
+	cfg.Client.Retries = 1
+	e := newTestExporter(t, &cfg)
+
+	svc := e.newService(cfg.Secrets[0])
+	col := NewEdgecastCollector(context.Background(), "main", &svc, metricSelection{3: metricTypes, 8: {metricBandwidth}}, cfg.collectorOptions())
+	want := `
+# HELP edgecast_bandwidth_bits_per_second Current bandwidth usage per platform in bits per second.
+# TYPE edgecast_bandwidth_bits_per_second gauge
+edgecast_bandwidth_bits_per_second{account="main",platform="http_large"} 42.42
+# HELP edgecast_connections Current active connections per platform.
+# TYPE edgecast_connections gauge
+edgecast_connections{account="main",platform="http_large"} 1234.1234
+# HELP edgecast_scrape_success Whether the last fetch from the Edgecast API succeeded per platform and metric type.
+# TYPE edgecast_scrape_success gauge
+edgecast_scrape_success{account="main",metric="bandwidth",platform="http_large"} 1
+edgecast_scrape_success{account="main",metric="bandwidth",platform="http_small"} 0
+edgecast_scrape_success{account="main",metric="cachestatus",platform="http_large"} 1
+edgecast_scrape_success{account="main",metric="connections",platform="http_large"} 1
+edgecast_scrape_success{account="main",metric="statuscodes",platform="http_large"} 1
+`
+	if err := testutil.CollectAndCompare(col, strings.NewReader(want), "edgecast_bandwidth_bits_per_second", "edgecast_connections", "edgecast_scrape_success"); err != nil {
+		t.Error(err)
+	}
+}
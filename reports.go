@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/trivago/exporter-edgecast/edgecast"
+)
+
+// reports that are fetched from the reporting API for every platform and interval
+const (
+	reportDataTransferred = "datatransferred"
+	reportCNAME           = "cname"
+	reportOrigin          = "origin"
+)
+
+var (
+	// trafficPlatforms lists the platforms the reporting API provides edge CNAME and customer origin reports for
+	trafficPlatforms = map[int]bool{edgecast.MediaTypeLarge: true, edgecast.MediaTypeSmall: true, edgecast.MediaTypeADN: true}
+
+	// Prepared Description of all metrics fetched from the reporting API
+	dataTransferred = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "", "data_transferred_bytes"), "Bytes transferred per platform within the latest complete interval, see edgecast_report_period_end_timestamp_seconds for its end.", []string{"account", "platform", "interval"}, nil,
+	)
+	cnameTraffic = trafficDescs{
+		bytes: prometheus.NewDesc(
+			prometheus.BuildFQName("edgecast", "cname", "data_transferred_bytes"), "Bytes transferred per platform and edge CNAME within the latest complete interval, see edgecast_report_period_end_timestamp_seconds for its end.", []string{"account", "platform", "cname", "interval"}, nil,
+		),
+		hits: prometheus.NewDesc(
+			prometheus.BuildFQName("edgecast", "cname", "hits"), "Requests per platform and edge CNAME within the latest complete interval, see edgecast_report_period_end_timestamp_seconds for its end.", []string{"account", "platform", "cname", "interval"}, nil,
+		),
+		bandwidth: prometheus.NewDesc(
+			prometheus.BuildFQName("edgecast", "cname", "bandwidth_bits_per_second"), "Average bandwidth per platform and edge CNAME within the latest complete interval in bits per second, see edgecast_report_period_end_timestamp_seconds for its end.", []string{"account", "platform", "cname", "interval"}, nil,
+		),
+	}
+	originTraffic = trafficDescs{
+		bytes: prometheus.NewDesc(
+			prometheus.BuildFQName("edgecast", "origin", "data_transferred_bytes"), "Bytes transferred per platform and customer origin within the latest complete interval, see edgecast_report_period_end_timestamp_seconds for its end.", []string{"account", "platform", "origin", "interval"}, nil,
+		),
+		hits: prometheus.NewDesc(
+			prometheus.BuildFQName("edgecast", "origin", "hits"), "Requests per platform and customer origin within the latest complete interval, see edgecast_report_period_end_timestamp_seconds for its end.", []string{"account", "platform", "origin", "interval"}, nil,
+		),
+		bandwidth: prometheus.NewDesc(
+			prometheus.BuildFQName("edgecast", "origin", "bandwidth_bits_per_second"), "Average bandwidth per platform and customer origin within the latest complete interval in bits per second, see edgecast_report_period_end_timestamp_seconds for its end.", []string{"account", "platform", "origin", "interval"}, nil,
+		),
+	}
+	reportSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "report", "success"), "Whether the last fetch from the Edgecast reporting API succeeded per platform, report and interval.", []string{"account", "platform", "report", "interval"}, nil,
+	)
+	reportLastSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "report", "last_success_timestamp_seconds"), "Timestamp of the last successful fetch from the Edgecast reporting API per platform, report and interval.", []string{"account", "platform", "report", "interval"}, nil,
+	)
+	reportPeriodEnd = prometheus.NewDesc(
+		prometheus.BuildFQName("edgecast", "report", "period_end_timestamp_seconds"), "End of the interval covered by the exposed report per platform, report and interval.", []string{"account", "platform", "report", "interval"}, nil,
+	)
+)
+
+// trafficDescs holds the descriptions of the metrics exposed per name of a traffic report
+type trafficDescs struct {
+	bytes     *prometheus.Desc
+	hits      *prometheus.Desc
+	bandwidth *prometheus.Desc
+}
+
+// describe() sends all descriptions to the channel
+func (d trafficDescs) describe(ch chan<- *prometheus.Desc) {
+	ch <- d.bytes
+	ch <- d.hits
+	ch <- d.bandwidth
+}
+
+// reportKey identifies a single report of a single platform and interval
+type reportKey struct {
+	platform int
+	report   string
+	interval edgecast.Interval
+}
+
+// reportResult holds the outcome of fetching a single report of a single platform and interval
+type reportResult struct {
+	reportKey
+	period    edgecast.ReportPeriod // period of the fetched data
+	data      interface{}           // *edgecast.DataTransferData or *edgecast.TrafficReportData (edge CNAMEs or customer origins)
+	err       error
+	fetched   time.Time // time of the last fetch, successful or not
+	timestamp time.Time // time of the last successful fetch
+}
+
+/*
+ * ReportPoller periodically fetches the reports of the given platforms from the Edgecast reporting API in the background.
+ * It runs on its own schedule next to the Poller of the real-time statistics:
+ * - every report covers the latest interval (hour or day) that is complete, i.e. that ended at least delay ago
+ * - the report of an interval is fetched once, further polls only fetch again once the next interval is complete or after a failure
+ */
+type ReportPoller struct {
+	ec        EdgecastInterface
+	platforms map[int]string
+	intervals []edgecast.Interval
+	cnames    bool           // additionally fetch the edge CNAME reports of the platforms supporting them
+	origins   bool           // additionally fetch the customer origin reports of the platforms supporting them
+	allow     *regexp.Regexp // names of edge CNAMEs and customer origins that are kept, all if nil
+	interval  time.Duration
+	delay     time.Duration
+
+	results *snapshot // latest reportResult per reportKey
+}
+
+// NewReportPoller constructs a new ReportPoller that fetches the configured reports of the given platforms
+func NewReportPoller(client *EdgecastInterface, platforms map[int]string, cfg ReportingConfig) *ReportPoller {
+	return &ReportPoller{
+		ec:        *client,
+		platforms: platforms,
+		intervals: cfg.intervals(),
+		cnames:    cfg.CNAMEs,
+		origins:   cfg.Origins,
+		allow:     cfg.allowList(),
+		interval:  cfg.PollInterval,
+		delay:     cfg.Delay,
+		results:   newSnapshot(),
+	}
+}
+
+// Run fetches the reports once immediately and then on every tick of the poll interval until ctx is done
+func (p *ReportPoller) Run(ctx context.Context) {
+	runEvery(ctx, p.interval, p.poll)
+}
+
+// keys() returns the reports fetched for every platform and interval
+func (p *ReportPoller) keys() []reportKey {
+	var keys []reportKey
+	for platform := range p.platforms {
+		for _, interval := range p.intervals {
+			keys = append(keys, reportKey{platform, reportDataTransferred, interval})
+			if p.cnames && trafficPlatforms[platform] {
+				keys = append(keys, reportKey{platform, reportCNAME, interval})
+			}
+			if p.origins && trafficPlatforms[platform] {
+				keys = append(keys, reportKey{platform, reportOrigin, interval})
+			}
+		}
+	}
+	return keys
+}
+
+// poll() concurrently fetches every report whose latest complete interval hasn't been fetched successfully yet
+// - failed fetches keep the previously fetched data, so the series of the previous interval are still exposed
+func (p *ReportPoller) poll(ctx context.Context) {
+	now := time.Now()
+	var wg sync.WaitGroup
+	for _, key := range p.keys() {
+		period := edgecast.LastComplete(key.interval, now.Add(-p.delay))
+		if prev, ok := p.results.get(key); ok && prev.(reportResult).err == nil && prev.(reportResult).period.End.Equal(period.End) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(key reportKey) {
+			defer wg.Done()
+			r := p.fetch(ctx, key, period)
+			p.results.update(key, func(prev interface{}, ok bool) interface{} {
+				if ok && r.err != nil {
+					prev := prev.(reportResult)
+					prev.err, prev.fetched = r.err, r.fetched
+					return prev
+				}
+				return r
+			})
+		}(key)
+	}
+	wg.Wait()
+}
+
+// fetch() fetches a single report of a single platform for the given period from the API
+func (p *ReportPoller) fetch(ctx context.Context, key reportKey, period edgecast.ReportPeriod) reportResult {
+	r := reportResult{reportKey: key, period: period}
+	switch key.report {
+	case reportDataTransferred:
+		r.data, r.err = p.ec.DataTransferred(ctx, key.platform, period)
+	case reportCNAME:
+		var data *edgecast.TrafficReportData
+		if data, r.err = p.ec.CNAMEReport(ctx, key.platform, period); r.err == nil {
+			r.data = p.allowed(data)
+		}
+	case reportOrigin:
+		var data *edgecast.TrafficReportData
+		if data, r.err = p.ec.OriginReport(ctx, key.platform, period); r.err == nil {
+			r.data = p.allowed(data)
+		}
+	}
+	r.fetched = time.Now()
+	if r.err == nil {
+		r.timestamp = r.fetched
+	}
+	return r
+}
+
+// allowed() returns the entries of a traffic report whose names match the allow list
+func (p *ReportPoller) allowed(data *edgecast.TrafficReportData) *edgecast.TrafficReportData {
+	if p.allow == nil {
+		return data
+	}
+	allowed := make(edgecast.TrafficReportData, 0, len(*data))
+	for _, entry := range *data {
+		if p.allow.MatchString(entry.Name) {
+			allowed = append(allowed, entry)
+		}
+	}
+	return &allowed
+}
+
+// seed() fills the snapshot with results of a previous report poller, e.g. after a reload
+// - only results of the poller's platforms and intervals are taken over
+func (p *ReportPoller) seed(results []reportResult) {
+	keys := make(map[reportKey]bool)
+	for _, key := range p.keys() {
+		keys[key] = true
+	}
+	for _, r := range results {
+		if keys[r.reportKey] {
+			p.results.set(r.reportKey, r)
+		}
+	}
+}
+
+// snapshot() returns the latest results of all platforms, reports and intervals
+func (p *ReportPoller) snapshot() []reportResult {
+	values := p.results.values()
+	results := make([]reportResult, 0, len(values))
+	for _, r := range values {
+		results = append(results, r.(reportResult))
+	}
+	return results
+}
+
+// ReportCollector serves the latest snapshot of a ReportPoller of an account
+type ReportCollector struct {
+	account string // value of the account label on every exposed series
+	poller  *ReportPoller
+}
+
+// NewReportCollector constructs a new ReportCollector for an account serving the snapshot of the given poller
+func NewReportCollector(account string, poller *ReportPoller) *ReportCollector {
+	return &ReportCollector{account: account, poller: poller}
+}
+
+// Describe describes all exported metrics
+// - implements function of interface prometheus.Collector
+func (col ReportCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dataTransferred
+	if col.poller.cnames {
+		cnameTraffic.describe(ch)
+	}
+	if col.poller.origins {
+		originTraffic.describe(ch)
+	}
+	ch <- reportSuccess
+	ch <- reportLastSuccess
+	ch <- reportPeriodEnd
+}
+
+// Collect exposes the poller's latest snapshot
+// - the reported data is exposed without timestamp, as it is older than Prometheus accepts, the end of its interval is exposed next to it
+// - implements function of interface prometheus.Collector
+func (col ReportCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, r := range col.poller.snapshot() {
+		platform, interval := Platforms[r.platform], r.interval.String()
+		successVal := 0.0
+		if r.err == nil {
+			successVal = 1
+		}
+		ch <- prometheus.MustNewConstMetric(reportSuccess, prometheus.GaugeValue, successVal, col.account, platform, r.report, interval)
+		if r.timestamp.IsZero() { // never fetched successfully, nothing to expose
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(reportLastSuccess, prometheus.GaugeValue, float64(r.timestamp.Unix()), col.account, platform, r.report, interval)
+		ch <- prometheus.MustNewConstMetric(reportPeriodEnd, prometheus.GaugeValue, float64(r.period.End.Unix()), col.account, platform, r.report, interval)
+
+		switch data := r.data.(type) {
+		case *edgecast.DataTransferData:
+			ch <- prometheus.MustNewConstMetric(dataTransferred, prometheus.GaugeValue, data.Bytes(), col.account, platform, interval)
+		case *edgecast.TrafficReportData:
+			descs := cnameTraffic
+			if r.report == reportOrigin {
+				descs = originTraffic
+			}
+			col.traffic(ch, descs, r, data)
+		}
+	}
+}
+
+// traffic() pushes the bytes, hits and average bandwidth of every name in a traffic report to the channel
+func (col ReportCollector) traffic(ch chan<- prometheus.Metric, descs trafficDescs, r reportResult, data *edgecast.TrafficReportData) {
+	platform, interval := Platforms[r.platform], r.interval.String()
+	seconds := r.period.End.Sub(r.period.Begin).Seconds()
+	for _, entry := range *data {
+		ch <- prometheus.MustNewConstMetric(descs.bytes, prometheus.GaugeValue, entry.Bytes, col.account, platform, entry.Name, interval)
+		ch <- prometheus.MustNewConstMetric(descs.hits, prometheus.GaugeValue, entry.Hits, col.account, platform, entry.Name, interval)
+		ch <- prometheus.MustNewConstMetric(descs.bandwidth, prometheus.GaugeValue, entry.Bytes*8/seconds, col.account, platform, entry.Name, interval)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/trivago/exporter-edgecast/edgecast"
+)
+
+// countingService counts the reports requested from the wrapped EdgecastInterface
+type countingService struct {
+	EdgecastInterface
+	reports int32
+}
+
+func (s *countingService) DataTransferred(ctx context.Context, platform int, period edgecast.ReportPeriod) (*edgecast.DataTransferData, error) {
+	atomic.AddInt32(&s.reports, 1)
+	return s.EdgecastInterface.DataTransferred(ctx, platform, period)
+}
+
+func (s *countingService) CNAMEReport(ctx context.Context, platform int, period edgecast.ReportPeriod) (*edgecast.TrafficReportData, error) {
+	atomic.AddInt32(&s.reports, 1)
+	return s.EdgecastInterface.CNAMEReport(ctx, platform, period)
+}
+
+func (s *countingService) OriginReport(ctx context.Context, platform int, period edgecast.ReportPeriod) (*edgecast.TrafficReportData, error) {
+	atomic.AddInt32(&s.reports, 1)
+	return s.EdgecastInterface.OriginReport(ctx, platform, period)
+}
+
+func TestReportCollector(t *testing.T) {
+	counting := &countingService{EdgecastInterface: fixtureService{t}}
+	var svc EdgecastInterface = counting
+	cfg := DefaultConfig().Reporting
+	cfg.Intervals, cfg.CNAMEs, cfg.Origins = []string{"hour"}, true, true
+	cfg.AllowList = []string{`static\..*`, "origin.example.com"}
+	poller := NewReportPoller(&svc, map[int]string{2: "flash", 3: "http_large"}, cfg)
+
+	poller.poll(context.Background())
+	end := edgecast.LastComplete(edgecast.IntervalHour, time.Now().Add(-cfg.Delay)).End
+	// flash has neither edge CNAME nor customer origin reports
+	if n := atomic.LoadInt32(&counting.reports); n != 4 {
+		t.Errorf("fetched %d reports, want 4", n)
+	}
+
+	col := NewReportCollector("main", poller)
+	want := fmt.Sprintf(`
+# HELP edgecast_data_transferred_bytes Bytes transferred per platform within the latest complete interval, see edgecast_report_period_end_timestamp_seconds for its end.
+# TYPE edgecast_data_transferred_bytes gauge
+edgecast_data_transferred_bytes{account="main",interval="hour",platform="flash"} 1.073741824e+09
+edgecast_data_transferred_bytes{account="main",interval="hour",platform="http_large"} 1.073741824e+09
+# HELP edgecast_report_period_end_timestamp_seconds End of the interval covered by the exposed report per platform, report and interval.
+# TYPE edgecast_report_period_end_timestamp_seconds gauge
+edgecast_report_period_end_timestamp_seconds{account="main",interval="hour",platform="flash",report="datatransferred"} %[1]d
+edgecast_report_period_end_timestamp_seconds{account="main",interval="hour",platform="http_large",report="cname"} %[1]d
+edgecast_report_period_end_timestamp_seconds{account="main",interval="hour",platform="http_large",report="datatransferred"} %[1]d
+edgecast_report_period_end_timestamp_seconds{account="main",interval="hour",platform="http_large",report="origin"} %[1]d
+# HELP edgecast_cname_data_transferred_bytes Bytes transferred per platform and edge CNAME within the latest complete interval, see edgecast_report_period_end_timestamp_seconds for its end.
+# TYPE edgecast_cname_data_transferred_bytes gauge
+edgecast_cname_data_transferred_bytes{account="main",cname="static.example.com",interval="hour",platform="http_large"} 5.36870912e+08
+# HELP edgecast_cname_hits Requests per platform and edge CNAME within the latest complete interval, see edgecast_report_period_end_timestamp_seconds for its end.
+# TYPE edgecast_cname_hits gauge
+edgecast_cname_hits{account="main",cname="static.example.com",interval="hour",platform="http_large"} 1200
+# HELP edgecast_origin_bandwidth_bits_per_second Average bandwidth per platform and customer origin within the latest complete interval in bits per second, see edgecast_report_period_end_timestamp_seconds for its end.
+# TYPE edgecast_origin_bandwidth_bits_per_second gauge
+edgecast_origin_bandwidth_bits_per_second{account="main",interval="hour",origin="origin.example.com",platform="http_large"} 298261.61777777775
+`, end.Unix())
+	err := testutil.CollectAndCompare(col, strings.NewReader(want),
+		"edgecast_data_transferred_bytes", "edgecast_report_period_end_timestamp_seconds", "edgecast_cname_data_transferred_bytes", "edgecast_cname_hits", "edgecast_origin_bandwidth_bits_per_second")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// the reports of the same interval are not fetched again
+	poller.poll(context.Background())
+	if n := atomic.LoadInt32(&counting.reports); n != 4 {
+		t.Errorf("fetched %d reports after the second poll, want still 4", n)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// healthzHandler reports that the process is alive, regardless of the state of the Edgecast API
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	_, _ = fmt.Fprintln(w, "OK")
+}
+
+/*
+ * readyHandler reports whether the exporter serves up-to-date metrics for all configured accounts:
+ * - 200:	the latest poll of every account fetched at least one metric type of one platform successfully
+ * - 503:	an account has not been fetched successfully yet, or all fetches of its latest poll failed
+ * Accounts without any active platform, e.g. as platform_metrics dropped all of them, are always ready.
+ */
+type readyHandler struct {
+	current func() *exporter // returns the exporter of the current configuration
+}
+
+func (h readyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var pending []string
+	for _, col := range h.current().collectors {
+		if !col.poller.ready() {
+			pending = append(pending, col.account)
+		}
+	}
+	if len(pending) > 0 {
+		http.Error(w, "not ready: "+strings.Join(pending, ", "), http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = fmt.Fprintln(w, "OK")
+}
+
+// landingHandler serves an HTML overview of the configured accounts and the latest fetch of every platform and metric type
+type landingHandler struct {
+	current func() *exporter // returns the exporter of the current configuration
+}
+
+// accountStatus holds the data of a single account shown on the landing page
+type accountStatus struct {
+	Account   string
+	Platforms []string
+	Ready     bool
+	Results   []resultStatus
+}
+
+// resultStatus holds the latest fetch of a single platform and metric type shown on the landing page
+type resultStatus struct {
+	Platform    string
+	Metric      string
+	LastFetch   string
+	LastSuccess string
+	Duration    time.Duration
+	Error       string
+}
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Edgecast Exporter</title></head>
+<body>
+<h1>Edgecast Exporter</h1>
+<p><a href="/metrics">Metrics</a> &middot; <a href="/healthz">Health</a> &middot; <a href="/ready">Readiness</a></p>
+{{range .}}
+<h2>{{.Account}}{{if not .Ready}} (not ready){{end}}</h2>
+<p>Platforms: {{range $i, $p := .Platforms}}{{if $i}}, {{end}}{{$p}}{{end}}</p>
+<table border="1" cellpadding="4">
+<tr><th>Platform</th><th>Metric</th><th>Last fetch</th><th>Last success</th><th>Duration</th><th>Last error</th></tr>
+{{range .Results}}<tr><td>{{.Platform}}</td><td>{{.Metric}}</td><td>{{.LastFetch}}</td><td>{{.LastSuccess}}</td><td>{{.Duration}}</td><td>{{.Error}}</td></tr>
+{{else}}<tr><td colspan="6">not fetched yet</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+func (h landingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	collectors := h.current().collectors
+	accounts := make([]accountStatus, 0, len(collectors))
+	for _, col := range collectors {
+		status := accountStatus{Account: col.account, Ready: col.poller.ready()}
+		for id, name := range col.metrics.platforms() {
+			status.Platforms = append(status.Platforms, fmt.Sprintf("%s (%d)", name, id))
+		}
+		sort.Strings(status.Platforms)
+
+		results := col.poller.snapshot()
+		sort.Slice(results, func(i, j int) bool {
+			if results[i].platform != results[j].platform {
+				return results[i].platform < results[j].platform
+			}
+			return results[i].metric < results[j].metric
+		})
+		for _, res := range results {
+			rs := resultStatus{
+				Platform:    Platforms[res.platform],
+				Metric:      res.metric,
+				LastFetch:   formatTime(res.fetched),
+				LastSuccess: formatTime(res.timestamp),
+				Duration:    res.duration.Round(time.Millisecond),
+			}
+			if res.err != nil {
+				rs.Error = res.err.Error()
+			}
+			status.Results = append(status.Results, rs)
+		}
+		accounts = append(accounts, status)
+	}
+
+	var page bytes.Buffer
+	if err := landingTemplate.Execute(&page, accounts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = page.WriteTo(w)
+}
+
+// formatTime() formats a fetch time for the landing page, "never" if it is unset
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
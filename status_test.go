@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trivago/exporter-edgecast/edgecast"
+)
+
+func TestHealthzHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	healthzHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+// newStatusExporter creates an exporter serving the polling collectors of the given accounts, which aren't polled until poll() is called
+func newStatusExporter(selections map[string]metricSelection, svc EdgecastInterface) *exporter {
+	e := &exporter{}
+	for account, selection := range selections {
+		poller := NewPoller(&svc, selection, time.Minute)
+		e.collectors = append(e.collectors, NewPollingEdgecastCollector(account, poller, collectorOptions{}))
+	}
+	return e
+}
+
+func TestReadyHandler(t *testing.T) {
+	svc := &breakerService{fixtureService: fixtureService{t}}
+	e := newStatusExporter(map[string]metricSelection{
+		"main":  {3: {metricBandwidth}},
+		"empty": {}, // all platforms dropped by platform_metrics
+	}, svc)
+	h := readyHandler{func() *exporter { return e }}
+	ready := func() (int, string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return rec.Code, rec.Body.String()
+	}
+	poll := func() {
+		for _, col := range e.collectors {
+			col.poller.poll(context.Background())
+		}
+	}
+
+	if code, body := ready(); code != http.StatusServiceUnavailable || strings.TrimSpace(body) != "not ready: main" {
+		t.Errorf("before the first poll: %d %q, want 503 for main only", code, body)
+	}
+	poll()
+	if code, body := ready(); code != http.StatusOK {
+		t.Errorf("after a successful poll: %d %q, want 200", code, body)
+	}
+	svc.err = &edgecast.ServerError{StatusCode: http.StatusBadGateway}
+	poll()
+	if code, body := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("after a failed poll: %d %q, want 503", code, body)
+	}
+	svc.err = nil
+	poll()
+	if code, body := ready(); code != http.StatusOK {
+		t.Errorf("after recovering: %d %q, want 200", code, body)
+	}
+}
+
+func TestLandingHandler(t *testing.T) {
+	svc := failingService{fixtureService{t}, 8}
+	e := newStatusExporter(map[string]metricSelection{"main": {3: {metricBandwidth}, 8: {metricBandwidth}}}, svc)
+	h := landingHandler{func() *exporter { return e }}
+	page := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	code, body := page("/")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	for _, want := range []string{"<h2>main (not ready)</h2>", "Platforms: http_large (3), http_small (8)", "not fetched yet"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page before the first poll lacks %q:\n%s", want, body)
+		}
+	}
+
+	e.collectors[0].poller.poll(context.Background())
+	_, body = page("/")
+	for _, want := range []string{"<h2>main</h2>", "<td>http_large</td><td>bandwidth</td>", "<td>http_small</td><td>bandwidth</td>", "server error", "never"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page after a poll lacks %q:\n%s", want, body)
+		}
+	}
+
+	if code, _ := page("/metrix"); code != http.StatusNotFound {
+		t.Errorf("status of an unknown path = %d, want 404", code)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+/*
+ * tokenFile provides the token of an account from a file, e.g. a mounted Kubernetes secret
+ * - the file is read again whenever its modification time or size changed, so the token rotates without a restart
+ * - the previous token is kept while the file cannot be read, e.g. while it is being replaced
+ * - every successful load is exported by the tokenLoaded gauge as Unix timestamp
+ */
+type tokenFile struct {
+	account     string
+	path        string
+	tokenLoaded metrics.Gauge
+
+	mtx     sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+// newTokenFile creates the token source of an account reading the given file
+func newTokenFile(account, path string, tokenLoaded metrics.Gauge) *tokenFile {
+	return &tokenFile{account: account, path: path, tokenLoaded: tokenLoaded}
+}
+
+// Token returns the content of the token file, reading it again if it changed since the last call
+// - implements function of interface edgecast.TokenSource
+func (f *tokenFile) Token() (string, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return f.fallback(err)
+	}
+	if f.token != "" && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.token, nil
+	}
+
+	token, err := readToken(f.path)
+	if err != nil {
+		return f.fallback(err)
+	}
+	f.token, f.modTime, f.size = token, info.ModTime(), info.Size()
+	f.tokenLoaded.With("account", f.account).Set(float64(time.Now().Unix()))
+	return f.token, nil
+}
+
+// fallback returns the previously loaded token if there is one, the given error otherwise
+func (f *tokenFile) fallback(err error) (string, error) {
+	if f.token != "" {
+		return f.token, nil
+	}
+	return "", err
+}
+
+// readToken reads the token from the given file, ignoring surrounding whitespace like a trailing newline
+func readToken(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	return token, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	loaded := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "edgecast_token_file_last_load_success_timestamp_seconds"}, []string{"account"})
+	tokens := newTokenFile("main", path, kitprometheus.NewGauge(loaded))
+	lastLoad := func() float64 { return testutil.ToFloat64(loaded.WithLabelValues("main")) }
+
+	// the file's content is used if it is set, a token that never loaded is an error
+	if _, err := tokens.Token(); err == nil {
+		t.Error("Token() of a missing file without previous token returned no error")
+	}
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Token(); err == nil {
+		t.Error("Token() of an empty file without previous token returned no error")
+	}
+	if got := lastLoad(); got != 0 {
+		t.Errorf("exported a load at %v although none succeeded", got)
+	}
+
+	// every step writes the content to the file, unless it is unchanged or the file is removed
+	tests := []struct {
+		name    string
+		content string
+		keep    bool // leave the file as it is
+		remove  bool
+		token   string
+		load    bool // whether the token is loaded from the file
+	}{
+		{name: "first token", content: "first\n", token: "first", load: true},
+		{name: "unchanged file", keep: true, token: "first"},
+		{name: "rotated token", content: "rotated-token\n", token: "rotated-token", load: true},
+		{name: "empty file", content: "", token: "rotated-token"},
+		{name: "whitespace only", content: " \n", token: "rotated-token"},
+		{name: "missing file", remove: true, token: "rotated-token"},
+		{name: "recreated file", content: "recreated\n", token: "recreated", load: true},
+	}
+	for _, tt := range tests {
+		switch {
+		case tt.remove:
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		case !tt.keep:
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		loaded.Reset()
+		begin := time.Now().Unix()
+		token, err := tokens.Token()
+		if err != nil {
+			t.Errorf("%s: Token() error = %v", tt.name, err)
+		}
+		if token != tt.token {
+			t.Errorf("%s: Token() = %q, want %q", tt.name, token, tt.token)
+		}
+		got := lastLoad()
+		if tt.load && (got < float64(begin) || got > float64(time.Now().Unix())) {
+			t.Errorf("%s: exported last load at %v, want the current time", tt.name, got)
+		}
+		if !tt.load && got != 0 {
+			t.Errorf("%s: exported a load at %v, want none", tt.name, got)
+		}
+	}
+}